@@ -0,0 +1,131 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+const DefaultDatabaseDriver = "postgres"
+
+// Config of the whole stack wired by NewApp
+type Config struct {
+	// DatabaseDriver "postgres" by default
+	DatabaseDriver string
+	// DatabaseDSN required
+	DatabaseDSN string
+	Database    DatabaseConfig
+	// Port the http server listens on, required
+	Port           int
+	GracefulReload bool
+	// Router routes, middlewares and options, the profiler and firewall middlewares are added by NewApp
+	Router RouterConfig
+	// Debug enables the dispatcher debug mode (profiles, history) and the router debug responses
+	Debug bool
+	// ProfilerEnabled saves request profiles into ProfilerDir, required then
+	ProfilerEnabled bool
+	ProfilerDir     string
+	// Firewall areas, the firewall middleware is only added when there are some
+	Firewall        FirewallConfig
+	FirewallOptions FirewallOptions
+	// TemplateDir enables the templating engine
+	TemplateDir       string
+	TemplateFunctions template.FuncMap
+}
+
+func (c Config) Validate() error {
+	err := validation.ValidateStruct(&c,
+		validation.Field(&c.DatabaseDSN, validation.Required),
+		validation.Field(&c.Port, validation.Required, validation.Min(1), validation.Max(65535)),
+		validation.Field(&c.ProfilerDir, validation.When(c.ProfilerEnabled, validation.Required)),
+	)
+	for _, area := range c.Firewall {
+		if area.Secure && area.Authenticator == nil {
+			errs, _ := err.(validation.Errors)
+			if errs == nil {
+				errs = validation.Errors{}
+			}
+			errs["Firewall"] = fmt.Errorf("secure area '%s' must have an Authenticator", area.Pattern)
+			return errs
+		}
+	}
+	return err
+}
+
+// App the modules wired by NewApp
+type App struct {
+	Config     Config
+	Storage    ModuleStorage
+	Dal        Dal
+	Health     HealthMonitor
+	Dispatcher EventDispatcher
+	Profiler   ModuleProfiler
+	Firewall   Firewall
+	Router     Router
+	Server     Server
+	Templating TemplatingEngine
+}
+
+// NewApp validates the config and constructs the modules, failing fast on invalid config or database connection.
+// The profiler (when enabled) and the firewall are merged into the router middlewares by priority, see SortMiddlewares.
+func NewApp(config Config) (*App, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if config.DatabaseDriver == "" {
+		config.DatabaseDriver = DefaultDatabaseDriver
+	}
+	app := &App{Config: config}
+	storage, err := NewModuleE(config.DatabaseDriver, config.DatabaseDSN, config.Database)
+	if err != nil {
+		return nil, err
+	}
+	app.Storage = storage
+	app.Dal = storage.Dal()
+	app.Health = storage.Health()
+	app.Dispatcher = NewDispatcherWithOptions(DispatcherOptions{Debug: config.Debug})
+
+	routerConfig := config.Router
+	routerConfig.NamedMiddlewares = append([]NamedMiddleware(nil), routerConfig.NamedMiddlewares...)
+	routerConfig.Debug = routerConfig.Debug || config.Debug
+	if routerConfig.Dispatcher == nil {
+		routerConfig.Dispatcher = app.Dispatcher
+	}
+	if config.ProfilerEnabled {
+		app.Profiler = NewModuleProfiler(true, config.ProfilerDir)
+		routerConfig.NamedMiddlewares = append(routerConfig.NamedMiddlewares, NamedMiddleware{
+			Name:       "profiler",
+			Priority:   MiddlewarePriorityProfiler,
+			Middleware: app.Profiler.HttpProfilerMiddleware().Handle,
+		})
+	}
+	if len(config.Firewall) > 0 {
+		app.Firewall = NewFirewallWithOptions(true, config.Firewall, app.Dispatcher, config.FirewallOptions)
+		routerConfig.NamedMiddlewares = append(routerConfig.NamedMiddlewares, NamedMiddleware{
+			Name:       "firewall",
+			Priority:   MiddlewarePriorityFirewall,
+			Middleware: app.Firewall.Handle,
+		})
+	}
+	app.Router = NewRouter(routerConfig)
+	app.Server = NewHttpServerWithConfig(app.Router, ServerConfig{Port: config.Port, GracefulReload: config.GracefulReload})
+	if config.TemplateDir != "" {
+		app.Templating = NewTemplatingEngineWithConfig(TemplatingConfig{
+			TemplateDir: config.TemplateDir,
+			Functions:   config.TemplateFunctions,
+			Router:      app.Router,
+			StaticFiles: routerConfig.StaticFiles,
+		})
+	}
+	return app, nil
+}
+
+// Serve runs the database health monitor and the http server until ctx is done
+func (a *App) Serve(ctx context.Context) {
+	go func() {
+		_ = a.Health.Run(ctx)
+	}()
+	a.Server.Serve(ctx)
+}
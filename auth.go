@@ -2,17 +2,77 @@ package core
 
 import (
 	"context"
+	"reflect"
 )
 
 const SecurityContextKey = "security-context"
 
 type SecurityContext struct {
 	Token GuardToken `json:"token"`
+	// RoleHierarchy used to resolve inherited roles
+	RoleHierarchy RoleHierarchy `json:"-"`
 }
 
+// Roles returns the roles of the authenticated user including inherited ones
+func (s SecurityContext) Roles() []string {
+	user, ok := s.User()
+	if !ok {
+		return nil
+	}
+	holder, ok := user.(RoleHolder)
+	if !ok {
+		return nil
+	}
+	return s.RoleHierarchy.ReachableRoles(holder.GetRoles())
+}
+
+func (s SecurityContext) HasRole(role string) bool {
+	return StringsContains(s.Roles(), role)
+}
+
+// FromContext reads the SecurityContext set by the firewall (request user value)
+// or by WithSecurityContext for plain contexts
 func FromContext(ctx context.Context) (SecurityContext, bool) {
-	s, ok := ctx.Value(SecurityContextKey).(SecurityContext)
-	return s, ok
+	if req, ok := ctx.(Request); ok {
+		return req.SecurityContext()
+	}
+	return SecurityContextValue.Get(ctx)
+}
+
+// WithSecurityContext attaches the SecurityContext to a plain context, e.g. background jobs
+func WithSecurityContext(ctx context.Context, securityContext SecurityContext) context.Context {
+	return SecurityContextValue.WithValue(ctx, securityContext)
+}
+
+func (r Request) SecurityContext() (SecurityContext, bool) {
+	return SecurityContextValue.Get(r)
+}
+
+// User returns the authenticated user, false for anonymous requests and client only tokens
+func (r Request) User() (UserInterface, bool) {
+	securityContext, ok := r.SecurityContext()
+	if !ok {
+		return nil, false
+	}
+	return securityContext.User()
+}
+
+func (s SecurityContext) User() (UserInterface, bool) {
+	if s.Token == nil {
+		return nil, false
+	}
+	user := s.Token.User()
+	if user == nil {
+		return nil, false
+	}
+	if v := reflect.ValueOf(user); v.Kind() == reflect.Ptr && v.IsNil() {
+		return nil, false
+	}
+	return user, true
+}
+
+func (r Request) setSecurityContext(securityContext SecurityContext) {
+	SecurityContextValue.Set(r, securityContext)
 }
 
 type UserInterface interface {
@@ -21,6 +81,11 @@ type UserInterface interface {
 	GetUsername() string
 }
 
+// RoleHolder implemented by users taking part in role based access control
+type RoleHolder interface {
+	GetRoles() []string
+}
+
 type GuardToken interface {
 	User() UserInterface
 	Provider() string
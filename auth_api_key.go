@@ -0,0 +1,58 @@
+package core
+
+import "context"
+
+const (
+	DefaultAPIKeyHeaderName = "X-API-Key"
+	APIKeyProviderName      = "api_key"
+)
+
+type APIKeyStorage interface {
+	// CheckCredentials returns the user the key is issued to, error for unknown or revoked keys,
+	// a nil user is rejected as well
+	CheckCredentials(ctx context.Context, key string) (UserInterface, error)
+}
+
+type APIKeyAuthToken struct {
+	user UserInterface
+}
+
+func (t APIKeyAuthToken) User() UserInterface {
+	return t.user
+}
+
+func (t APIKeyAuthToken) Provider() string {
+	return APIKeyProviderName
+}
+
+type APIKeyAuthenticator interface {
+	Authenticate(r Request) (GuardToken, error)
+}
+
+type apiKeyAuthenticator struct {
+	headerName string
+	storage    APIKeyStorage
+}
+
+func NewAPIKeyAuthenticator(storage APIKeyStorage, headerName ...string) APIKeyAuthenticator {
+	name := DefaultAPIKeyHeaderName
+	if len(headerName) > 0 && headerName[0] != "" {
+		name = headerName[0]
+	}
+	return &apiKeyAuthenticator{headerName: name, storage: storage}
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r Request) (GuardToken, error) {
+	key := r.Request.Header.Peek(a.headerName)
+	if len(key) == 0 {
+		return nil, AuthorizationRequiredErr()
+	}
+	user, err := a.storage.CheckCredentials(r, string(key))
+	if err != nil {
+		return nil, AuthorizationRequiredErr()
+	}
+	if isNilValue(user) {
+		return nil, UnauthorizedErr()
+	}
+	return APIKeyAuthToken{user: user}, nil
+}
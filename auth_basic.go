@@ -0,0 +1,78 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+const (
+	BasicProviderName         = "basic"
+	WWWAuthenticateHeaderName = "WWW-Authenticate"
+	DefaultBasicRealm         = "Restricted"
+)
+
+type BasicAuthToken struct {
+	user UserInterface
+}
+
+func (t BasicAuthToken) User() UserInterface {
+	return t.user
+}
+
+func (t BasicAuthToken) Provider() string {
+	return BasicProviderName
+}
+
+type BasicAuthenticator interface {
+	Authenticate(r Request) (GuardToken, error)
+}
+
+type basicAuthenticator struct {
+	realm       string
+	userStorage UserStorage
+}
+
+func NewBasicAuthenticator(userStorage UserStorage, realm ...string) BasicAuthenticator {
+	r := DefaultBasicRealm
+	if len(realm) > 0 && realm[0] != "" {
+		r = realm[0]
+	}
+	return &basicAuthenticator{realm: r, userStorage: userStorage}
+}
+
+func (a *basicAuthenticator) Authenticate(r Request) (GuardToken, error) {
+	username, password, ok := parseBasicAuth(r.Request.Header.Peek("Authorization"))
+	if !ok {
+		a.challenge(r)
+		return nil, AuthorizationRequiredErr()
+	}
+	user, err := a.userStorage.CheckCredentials(r, username, password)
+	if err != nil || user == nil {
+		a.challenge(r)
+		return nil, InvalidCredentialsErr()
+	}
+	return BasicAuthToken{user: user}, nil
+}
+
+// challenge makes browsers prompt for credentials
+func (a *basicAuthenticator) challenge(r Request) {
+	r.Response.Header.Set(WWWAuthenticateHeaderName, fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, a.realm))
+}
+
+func parseBasicAuth(header []byte) (string, string, bool) {
+	const prefix = "basic "
+	if len(header) < len(prefix) || !bytes.EqualFold(header[:len(prefix)], []byte(prefix)) {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(header[len(prefix):]))
+	if err != nil {
+		return "", "", false
+	}
+	sep := strings.IndexByte(string(decoded), ':')
+	if sep < 0 {
+		return "", "", false
+	}
+	return string(decoded[:sep]), string(decoded[sep+1:]), true
+}
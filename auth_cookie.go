@@ -0,0 +1,191 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	DefaultAuthCookieName = "punqy_session"
+	CookieProviderName    = "cookie"
+)
+
+var (
+	errCookieMalformed = errors.New("malformed signed cookie")
+	errCookieSignature = errors.New("invalid cookie signature")
+	errCookieExpired   = errors.New("cookie expired")
+)
+
+// cookieSigner signs a value with HMAC-SHA256 and embeds an expiry, format: base64(value|unix).base64(mac)
+type cookieSigner struct {
+	secret []byte
+}
+
+func (s cookieSigner) sign(value string, expiresAt time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s|%d", value, expiresAt.Unix())))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+func (s cookieSigner) verify(signed string) (string, error) {
+	parts := strings.Split(signed, ".")
+	if len(parts) != 2 {
+		return "", errCookieMalformed
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errCookieMalformed
+	}
+	if !hmac.Equal(mac, s.mac(parts[0])) {
+		return "", errCookieSignature
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", errCookieMalformed
+	}
+	sep := strings.LastIndex(string(decoded), "|")
+	if sep < 0 {
+		return "", errCookieMalformed
+	}
+	expiresAt, err := strconv.ParseInt(string(decoded[sep+1:]), 10, 64)
+	if err != nil {
+		return "", errCookieMalformed
+	}
+	if time.Now().Unix() > expiresAt {
+		return "", errCookieExpired
+	}
+	return string(decoded[:sep]), nil
+}
+
+func (s cookieSigner) mac(payload string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+type CookieAuthConfig struct {
+	Name   string
+	Secret []byte
+	// SessionTTL lifetime of a session cookie, discarded by the browser on close
+	SessionTTL time.Duration
+	// RememberMeTTL lifetime of a persistent cookie
+	RememberMeTTL time.Duration
+	Path          string
+	Domain        string
+	Secure        bool
+	SameSite      fasthttp.CookieSameSite
+}
+
+type CookieAuthToken struct {
+	user UserInterface
+}
+
+func (t CookieAuthToken) User() UserInterface {
+	return t.user
+}
+
+func (t CookieAuthToken) Provider() string {
+	return CookieProviderName
+}
+
+// CookieAuthenticator stateless cookie sessions, the cookie carries the signed user id and expiry only.
+// Sessions cannot be revoked on the server before they expire, other than by removing the user
+// (FindUserByID returning no user) or rotating the Secret, which ends all of them.
+type CookieAuthenticator interface {
+	Authenticate(r Request) (GuardToken, error)
+	// Login issues the signed cookie, persistent when rememberMe is set
+	Login(r Request, user UserInterface, rememberMe bool)
+	// Logout clears the cookie in the browser, a copy of it stays valid until it expires
+	Logout(r Request)
+}
+
+type cookieAuthenticator struct {
+	config       CookieAuthConfig
+	signer       cookieSigner
+	userProvider UserProvider
+}
+
+func NewCookieAuthenticator(config CookieAuthConfig, userProvider UserProvider) CookieAuthenticator {
+	if len(config.Secret) == 0 {
+		panic("Cookie authenticator requires a secret.")
+	}
+	if config.Name == "" {
+		config.Name = DefaultAuthCookieName
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.SessionTTL <= 0 {
+		config.SessionTTL = 24 * time.Hour
+	}
+	if config.RememberMeTTL <= 0 {
+		config.RememberMeTTL = 30 * 24 * time.Hour
+	}
+	if config.SameSite == fasthttp.CookieSameSiteDisabled {
+		config.SameSite = fasthttp.CookieSameSiteLaxMode
+	}
+	return &cookieAuthenticator{config: config, signer: cookieSigner{secret: config.Secret}, userProvider: userProvider}
+}
+
+func (a *cookieAuthenticator) Authenticate(r Request) (GuardToken, error) {
+	value := r.Request.Header.Cookie(a.config.Name)
+	if len(value) == 0 {
+		return nil, AuthorizationRequiredErr()
+	}
+	userID, err := a.signer.verify(string(value))
+	if errors.Is(err, errCookieExpired) {
+		return nil, AuthorizationExpiredErr()
+	}
+	if err != nil {
+		return nil, InvalidCredentialsErr()
+	}
+	user, err := a.userProvider.FindUserByID(r, userID)
+	if err != nil {
+		return nil, err
+	}
+	// a deleted user must not leave an authenticated session without a user, typed nil pointers included
+	if isNilValue(user) {
+		return nil, UnauthorizedErr()
+	}
+	return CookieAuthToken{user: user}, nil
+}
+
+func (a *cookieAuthenticator) Login(r Request, user UserInterface, rememberMe bool) {
+	ttl := a.config.SessionTTL
+	if rememberMe {
+		ttl = a.config.RememberMeTTL
+	}
+	expiresAt := time.Now().Add(ttl)
+	cookie := a.cookie(a.signer.sign(user.GetID(), expiresAt))
+	if rememberMe {
+		cookie.SetExpire(expiresAt)
+	}
+	r.Response.Header.SetCookie(cookie)
+	fasthttp.ReleaseCookie(cookie)
+}
+
+func (a *cookieAuthenticator) Logout(r Request) {
+	cookie := a.cookie("")
+	cookie.SetExpire(fasthttp.CookieExpireDelete)
+	r.Response.Header.SetCookie(cookie)
+	fasthttp.ReleaseCookie(cookie)
+}
+
+func (a *cookieAuthenticator) cookie(value string) *fasthttp.Cookie {
+	cookie := fasthttp.AcquireCookie()
+	cookie.SetKey(a.config.Name)
+	cookie.SetValue(value)
+	cookie.SetPath(a.config.Path)
+	cookie.SetDomain(a.config.Domain)
+	cookie.SetSecure(a.config.Secure)
+	cookie.SetHTTPOnly(true)
+	cookie.SetSameSite(a.config.SameSite)
+	return cookie
+}
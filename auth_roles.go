@@ -0,0 +1,49 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AttrRoles per route required roles, []string or string, the user must have any of them
+const AttrRoles = "roles"
+
+// NewRolesMiddleware enforces the AttrRoles of the matched route against the roles of the
+// authenticated user, inherited roles are resolved with the firewall RoleHierarchy.
+// Must run after the firewall, routes without AttrRoles pass through.
+func NewRolesMiddleware() Middleware {
+	return func(req Request, next Handler) Response {
+		attr, ok := req.Attr(AttrRoles)
+		if !ok {
+			return next(req)
+		}
+		required, err := requiredRoles(attr)
+		if err != nil {
+			return NewErrorJSONResponse(InternalServerErr(err.Error()))
+		}
+		if len(required) == 0 {
+			return next(req)
+		}
+		securityContext, ok := req.SecurityContext()
+		if !ok {
+			return NewErrorJSONResponse(AuthorizationRequiredErr())
+		}
+		for _, role := range required {
+			if securityContext.HasRole(role) {
+				return next(req)
+			}
+		}
+		return NewErrorJSONResponse(AccessDeniedErr(fmt.Sprintf("One of roles %s required", strings.Join(required, ", "))))
+	}
+}
+
+// requiredRoles reads the AttrRoles value, checked by the router when the route is registered
+func requiredRoles(attr interface{}) ([]string, error) {
+	switch roles := attr.(type) {
+	case []string:
+		return roles, nil
+	case string:
+		return []string{roles}, nil
+	}
+	return nil, fmt.Errorf("route attr %s must be []string or string, %T given", AttrRoles, attr)
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+type testUser struct {
+	id string
+}
+
+func (u testUser) GetID() string {
+	return u.id
+}
+
+func (u testUser) GetPassword() string {
+	return ""
+}
+
+func (u testUser) GetUsername() string {
+	return u.id
+}
+
+type testToken struct {
+	user UserInterface
+}
+
+func (t testToken) User() UserInterface {
+	return t.user
+}
+
+func (t testToken) Provider() string {
+	return "test"
+}
+
+// testAuthenticator authenticates every request carrying an Authorization header as the user "alice"
+type testAuthenticator struct {
+	calls int
+}
+
+func (a *testAuthenticator) Authenticate(req Request) (GuardToken, error) {
+	a.calls++
+	if len(req.Request.Header.Peek("Authorization")) == 0 {
+		return nil, errors.New("missing credentials")
+	}
+	return testToken{user: testUser{id: "alice"}}, nil
+}
+
+func newTestRequest(method string, path string, headers ...Header) Request {
+	var r fasthttp.Request
+	r.Header.SetMethod(method)
+	r.SetRequestURI(path)
+	for _, h := range headers {
+		r.Header.Set(h.Name, h.Value)
+	}
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&r, nil, nil)
+	return NewRequest(ctx, Route{})
+}
+
+func TestFirewallExposesAuthenticatedUser(t *testing.T) {
+	f := NewFirewall(true, FirewallConfig{{Pattern: "^/api", Secure: true, Authenticator: &testAuthenticator{}}}, nil)
+	req := newTestRequest(Get, "/api/me", Header{Name: "Authorization", Value: "Bearer token"})
+
+	resp := f.Handle(req, func(req Request) Response {
+		securityContext, ok := req.SecurityContext()
+		if !ok || securityContext.Token == nil {
+			t.Fatal("expected the security context on the request")
+		}
+		user, ok := req.User()
+		if !ok || user.GetID() != "alice" {
+			t.Errorf("expected Request.User to be alice, got %v", user)
+		}
+		fromContext, ok := FromContext(req)
+		if !ok {
+			t.Fatal("expected FromContext to find the security context")
+		}
+		if user, ok := fromContext.User(); !ok || user.GetID() != "alice" {
+			t.Errorf("expected FromContext user to be alice, got %v", user)
+		}
+		return NewResponse(nil, nil, fasthttp.StatusOK)
+	})
+
+	if resp.GetCode() != fasthttp.StatusOK {
+		t.Errorf("expected 200, got %d", resp.GetCode())
+	}
+}
@@ -1,13 +1,21 @@
 package core
 
-import "github.com/spf13/cobra"
+import (
+	"context"
+
+	"github.com/spf13/cobra"
+)
 
 type Executable func(cmd *cobra.Command, args []string)
 
+// ExecutableE is an Executable returning its error, Execute returns it instead of exiting
+type ExecutableE func(cmd *cobra.Command, args []string) error
+
 type Commands []Command
 
 type Command struct {
 	Run      Executable
+	RunE     ExecutableE
 	Use      string
 	Args     cobra.PositionalArgs
 	Long     string
@@ -27,9 +35,20 @@ func bindCommands(commands Commands, root *cobra.Command) {
 			Use:   cmd.Use,
 			Short: cmd.Short,
 			Run:   cmd.Run,
+			RunE:  cmd.RunE,
 			Args:  cmd.Args,
+			// failures of RunE are not usage errors
+			SilenceUsage: cmd.RunE != nil,
 		}
 		root.AddCommand(cobraCmd)
 		bindCommands(cmd.Children, cobraCmd)
 	}
 }
+
+// CommandContext returns the command context, background when executed without one
+func CommandContext(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"io"
@@ -78,3 +80,18 @@ func Decrypt(encryptedString string, keyString string) (string, error) {
 
 	return fmt.Sprintf("%s", plaintext), err
 }
+
+// GenerateToken returns nBytes of crypto/rand randomness as URL-safe base64 without padding
+func GenerateToken(nBytes int) (string, error) {
+	b := make([]byte, nBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken hex encoded SHA-256 of the token, for storing tokens at rest
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
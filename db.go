@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"reflect"
+	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,16 +14,96 @@ import (
 	"github.com/lib/pq"
 	_ "github.com/lib/pq"
 	"github.com/pkg/errors"
-	logger "github.com/sirupsen/logrus"
 	"github.com/slmder/qbuilder"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/multierr"
 )
 
 type DatabaseConfig struct {
+	// ReplicaDsn optional read replica dsn, read only queries are routed there
+	ReplicaDsn string
+	Connection ConnectionConfig
+	Dal        DalConfig
+	// ConnectRetries number of additional connect attempts on startup
+	ConnectRetries int
+	// ConnectBackoff delay before the first retry, doubled on every next one
+	ConnectBackoff time.Duration
+	// Health configures the monitor returned by ModuleStorage.Health
+	Health HealthMonitorConfig
+}
+
+// ConnectionConfig connection pool settings, zero values keep database/sql defaults
+type ConnectionConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+func (c ConnectionConfig) apply(db *sqlx.DB) {
+	if c.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
 }
 
-func NewConnection(driverName, dsn string) *sqlx.DB {
-	return sqlx.MustConnect(driverName, dsn)
+type DalConfig struct {
+	// Replica connection used for read only queries outside of transaction
+	Replica *sqlx.DB
+	// DisableReplicaReads routes every query to the primary connection
+	DisableReplicaReads bool
+	// AutoTimestamps stamps `dal:"auto"` tagged created_at/updated_at fields on DoInsert/DoUpdate
+	AutoTimestamps bool
+	// TracerProvider enables query spans when set
+	TracerProvider trace.TracerProvider
+	// QueryCache backs DoSelectCached, in-memory by default
+	QueryCache QueryCache
+	// Dialect placeholders style of the built queries, DialectPostgres by default
+	Dialect Dialect
+	// ExplainQueries attaches the EXPLAIN (FORMAT JSON) plan of every profiled select, dev only as it doubles the queries
+	ExplainQueries bool
+}
+
+func NewConnection(driverName, dsn string, config ...ConnectionConfig) *sqlx.DB {
+	db, err := NewConnectionE(driverName, dsn, config...)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+func NewConnectionE(driverName, dsn string, config ...ConnectionConfig) (*sqlx.DB, error) {
+	db, err := sqlx.Connect(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if len(config) > 0 {
+		config[0].apply(db)
+	}
+	return db, nil
+}
+
+func connectWithRetry(driverName, dsn string, cfg DatabaseConfig) (*sqlx.DB, error) {
+	backoff := cfg.ConnectBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	db, err := NewConnectionE(driverName, dsn, cfg.Connection)
+	for attempt := 1; err != nil && attempt <= cfg.ConnectRetries; attempt++ {
+		GetLogger().Warn("database connect failed", Fields{"error": err.Error(), "attempt": attempt, "retries": cfg.ConnectRetries, "backoff": backoff.String()})
+		time.Sleep(backoff)
+		backoff *= 2
+		db, err = NewConnectionE(driverName, dsn, cfg.Connection)
+	}
+	return db, err
 }
 
 type txKeyType string
@@ -42,12 +123,28 @@ type (
 
 type Dal interface {
 	Connection() *sqlx.DB
+	// Ping checks the primary and, when configured, the replica connection
+	Ping(ctx context.Context) error
 	Transaction(ctx context.Context) *sqlx.Tx
 	DoInsert(ctx context.Context, sql string, entity interface{}) (sql.Result, error)
+	DoInsertReturning(ctx context.Context, sql string, entity interface{}, dest interface{}) error
 	DoUpdate(ctx context.Context, sql string, entity interface{}) (sql.Result, error)
+	DoUpdateVersioned(ctx context.Context, sql string, entity interface{}) (sql.Result, error)
+	DoUpdateChecked(ctx context.Context, sql string, entity interface{}) error
+	DoPatch(ctx context.Context, tableName string, id interface{}, changes map[string]interface{}, allowed []string) error
+	DoInsertArgs(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	DoUpdateArgs(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	DoExec(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	DoExecNamed(ctx context.Context, query string, arg interface{}) (sql.Result, error)
 	DoSelect(ctx context.Context, dest interface{}, query string, args ...interface{}) error
 	DoSelectOne(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	DoSelectScalar(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	DoSelectEach(ctx context.Context, fn func(scan RowScanner) error, query string, args ...interface{}) error
+	DoSelectCached(ctx context.Context, ttl time.Duration, dest interface{}, query string, args ...interface{}) error
+	InvalidateQueryCache(prefix string)
 	Transactional(ctx context.Context, cb func(ctx context.Context) error) error
+	// Batch buffers write statements to execute them in one round trip, see Batch
+	Batch(ctx context.Context) Batch
 	SubSelect(sel string) *qbuilder.SelectBuilder
 	BuildSelect(sel ...string) *qbuilder.SelectBuilder
 	SelectE(obj interface{}, alias ...string) *qbuilder.SelectBuilder
@@ -59,65 +156,149 @@ type Dal interface {
 	DeleteE(ctx context.Context, table string, obj interface{}, where ...string) (sql.Result, error)
 	ToArgsAndExpressions(conditions map[string]interface{}) ([]interface{}, []string)
 	PipeErr(err error) error
-	FindBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination) error
-	FindOneBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions) error
+	FindBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination, opts ...FindOptions) error
+	FindByPaged(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination, opts ...FindOptions) (uint64, error)
+	FindOneBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, opts ...FindOptions) error
+	FindByCursor(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, cursorCol string, after interface{}, limit uint32, opts ...FindOptions) (interface{}, error)
 	SoftDelete(ctx context.Context, tableName string, id uuid.UUID) error
+	SoftDeleteByKey(ctx context.Context, tableName string, key qbuilder.Conditions) error
+	SoftDeleteWhere(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error)
+	Delete(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error)
 	Execute(ctx context.Context, sql string, args ...interface{}) (sql.Result, error)
 }
 
 type dal struct {
 	conn            *sqlx.DB
+	replica         *sqlx.DB
 	transactions    Transactions
 	profilerEnabled bool
+	autoTimestamps  bool
+	tracer          trace.Tracer
+	queryCache      QueryCache
+	explainQueries  bool
+	dialect         Dialect
+}
+
+func NewDAL(conn *sqlx.DB, tm Transactions, config ...DalConfig) Dal {
+	d := &dal{conn: conn, transactions: tm, profilerEnabled: true, queryCache: NewMemoryQueryCache(), dialect: DialectPostgres}
+	if len(config) > 0 {
+		cfg := config[0]
+		if cfg.Replica != nil && !cfg.DisableReplicaReads {
+			d.replica = cfg.Replica
+		}
+		d.autoTimestamps = cfg.AutoTimestamps
+		if cfg.TracerProvider != nil {
+			d.tracer = cfg.TracerProvider.Tracer(TracerName)
+		}
+		if cfg.QueryCache != nil {
+			d.queryCache = cfg.QueryCache
+		}
+		d.explainQueries = cfg.ExplainQueries
+		if cfg.Dialect != "" {
+			d.dialect = cfg.Dialect
+		}
+	}
+	return d
 }
 
-func NewDAL(conn *sqlx.DB, tm Transactions) Dal {
-	return &dal{conn: conn, transactions: tm, profilerEnabled: true}
+func (d *dal) Connection() *sqlx.DB {
+	return d.conn
 }
 
-func (d *dal) Connection() *sqlx.DB {
+func (d *dal) Ping(ctx context.Context) error {
+	err := d.conn.PingContext(ctx)
+	if d.replica != nil {
+		if replicaErr := d.replica.PingContext(ctx); replicaErr != nil {
+			err = multierr.Append(err, fmt.Errorf("replica: %w", replicaErr))
+		}
+	}
+	return Wrap(err)
+}
+
+// readConnection returns the replica connection when configured, primary otherwise.
+// Must not be used inside transaction.
+func (d *dal) readConnection() *sqlx.DB {
+	if d.replica != nil {
+		return d.replica
+	}
 	return d.conn
 }
 
+type queryTagKeyType string
+
+const queryTagKey = queryTagKeyType("db.query.tag")
+
+// WithQueryTag labels the queries issued with ctx, e.g. by repository, in the profiler and query spans
+func WithQueryTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, queryTagKey, tag)
+}
+
+func QueryTag(ctx context.Context) string {
+	tag, _ := ctx.Value(queryTagKey).(string)
+	return tag
+}
+
 func (d *dal) pipeQueryLog(ctx context.Context, query string, args []interface{}, call func() error) error {
-	if !d.profilerEnabled {
-		return call()
+	if recorder := queryRecorderFromContext(ctx); recorder != nil {
+		recorder.record(query, args)
+		if recorder.dryRun {
+			return nil
+		}
 	}
-	appContext, ok := ctx.Value(profileContextKey).(*Profile)
-	if !ok {
+	profile, profiling := ProfileValue.Get(ctx)
+	profiling = profiling && d.profilerEnabled
+	if !profiling && d.tracer == nil {
 		return call()
 	}
+	var span trace.Span
+	tag := QueryTag(ctx)
+	if d.tracer != nil {
+		span = startQuerySpan(ctx, d.tracer, query, tag)
+	}
 	start := time.Now()
-	defer func(ctx context.Context) {
-		appContext.AddQueryProfile(query, time.Now().Sub(start).Seconds(), args)
-	}(ctx)
-	return call()
+	err := call()
+	duration := time.Now().Sub(start).Seconds()
+	if profiling {
+		profile.AddQueryProfile(query, duration, args, tag)
+		if d.explainQueries && err == nil {
+			if plan := d.explain(ctx, query, args); plan != nil {
+				profile.SqlQueries[len(profile.SqlQueries)-1].Plan = plan
+			}
+		}
+	}
+	if span != nil {
+		endQuerySpan(span, duration, err)
+	}
+	return err
 }
 
 func (d *dal) pipeResultQueryLog(ctx context.Context, query string, args []interface{}, call func() (sql.Result, error)) (sql.Result, error) {
-	if !d.profilerEnabled {
-		return call()
-	}
-	appContext, ok := ctx.Value(profileContextKey).(*Profile)
-	if !ok {
-		return call()
+	var result sql.Result
+	err := d.pipeQueryLog(ctx, query, args, func() error {
+		var err error
+		result, err = call()
+		return err
+	})
+	if result == nil && err == nil && isDryRun(ctx) {
+		return queryRecorderFromContext(ctx).result(), nil
 	}
-	start := time.Now()
-	defer func(ctx context.Context) {
-		appContext.AddQueryProfile(query, time.Now().Sub(start).Seconds(), args)
-	}(ctx)
-	return call()
+	return result, err
 }
 
 func (d *dal) Transaction(ctx context.Context) *sqlx.Tx {
 	tx := getTransactionFromContext(ctx)
 	if tx == nil {
-		logger.Error("transaction not found in given context")
+		LoggerFromContext(ctx).Error("transaction not found in given context")
 	}
 	return tx
 }
 
+// Execute alias of DoExec
 func (d *dal) Execute(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.DoExec(ctx, query, args...)
+}
+
+func (d *dal) DoExec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
 	return d.pipeResultQueryLog(ctx, query, args, func() (sql.Result, error) {
 		tx := getTransactionFromContext(ctx)
 		if tx == nil {
@@ -130,25 +311,79 @@ func (d *dal) Execute(ctx context.Context, query string, args ...interface{}) (s
 }
 
 func (d *dal) DoInsert(ctx context.Context, query string, entity interface{}) (sql.Result, error) {
-	return d.pipeResultQueryLog(ctx, query, []interface{}{entity}, func() (sql.Result, error) {
-		tx := getTransactionFromContext(ctx)
-		if tx == nil {
-			result, err := d.Connection().NamedExecContext(ctx, query, entity)
-			return result, d.PipeErr(err)
+	if d.autoTimestamps {
+		stampTimestamps(entity, ColumnCreatedAt, ColumnUpdatedAt)
+	}
+	return d.DoExecNamed(ctx, query, entity)
+}
+
+// DoInsertReturning executes the named insert query with a RETURNING clause and scans the returned row into dest,
+// dest may be the entity itself to fill db generated columns
+func (d *dal) DoInsertReturning(ctx context.Context, query string, entity interface{}, dest interface{}) error {
+	if d.autoTimestamps {
+		stampTimestamps(entity, ColumnCreatedAt, ColumnUpdatedAt)
+	}
+	return d.pipeQueryLog(ctx, query, []interface{}{entity}, func() error {
+		var e sqlx.ExtContext = d.Connection()
+		if tx := getTransactionFromContext(ctx); tx != nil {
+			e = tx
 		}
-		result, err := tx.NamedExecContext(ctx, query, entity)
-		return result, d.PipeErr(err)
+		rows, err := sqlx.NamedQueryContext(ctx, e, query, entity)
+		if err != nil {
+			return d.PipeErr(err)
+		}
+		defer rows.Close()
+		if !rows.Next() {
+			if err := rows.Err(); err != nil {
+				return d.PipeErr(err)
+			}
+			return ObjectNotFoundErr()
+		}
+		if err := scanRow(rows, dest); err != nil {
+			return d.PipeErr(err)
+		}
+		return d.PipeErr(rows.Err())
 	})
 }
 
 func (d *dal) DoUpdate(ctx context.Context, query string, entity interface{}) (sql.Result, error) {
-	return d.pipeResultQueryLog(ctx, query, []interface{}{entity}, func() (sql.Result, error) {
+	if d.autoTimestamps {
+		stampTimestamps(entity, ColumnUpdatedAt)
+	}
+	return d.DoExecNamed(ctx, query, entity)
+}
+
+// DoUpdateChecked executes DoUpdate and returns ObjectNotFoundErr when no rows were affected
+func (d *dal) DoUpdateChecked(ctx context.Context, query string, entity interface{}) error {
+	affected, err := AffectedRows(d.DoUpdate(ctx, query, entity))
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ObjectNotFoundErr()
+	}
+	return nil
+}
+
+// DoInsertArgs positional ($1, $2...) variant of DoInsert
+func (d *dal) DoInsertArgs(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.DoExec(ctx, query, args...)
+}
+
+// DoUpdateArgs positional ($1, $2...) variant of DoUpdate
+func (d *dal) DoUpdateArgs(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return d.DoExec(ctx, query, args...)
+}
+
+// DoExecNamed named (:name) variant of DoExec, arg is a struct or a map
+func (d *dal) DoExecNamed(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return d.pipeResultQueryLog(ctx, query, []interface{}{arg}, func() (sql.Result, error) {
 		tx := getTransactionFromContext(ctx)
 		if tx == nil {
-			result, err := d.Connection().NamedExecContext(ctx, query, entity)
+			result, err := d.Connection().NamedExecContext(ctx, query, arg)
 			return result, d.PipeErr(err)
 		}
-		result, err := tx.NamedExecContext(ctx, query, entity)
+		result, err := tx.NamedExecContext(ctx, query, arg)
 		return result, d.PipeErr(err)
 	})
 }
@@ -157,7 +392,7 @@ func (d *dal) DoSelectOne(ctx context.Context, dest interface{}, query string, a
 	return d.pipeQueryLog(ctx, query, args, func() error {
 		tx := getTransactionFromContext(ctx)
 		if tx == nil {
-			err := d.Connection().GetContext(ctx, dest, query, args...)
+			err := d.readConnection().GetContext(ctx, dest, query, args...)
 			return d.PipeErr(err)
 		}
 		err := tx.Get(dest, query, args...)
@@ -165,11 +400,23 @@ func (d *dal) DoSelectOne(ctx context.Context, dest interface{}, query string, a
 	})
 }
 
+// DoSelectScalar scans the first column of the first row into dest, e.g. COUNT(*), MAX(created_at) or a single column.
+// Returns ObjectNotFoundErr on no rows, a NULL value requires a nullable dest (pointer, sql.Null*)
+func (d *dal) DoSelectScalar(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return d.pipeQueryLog(ctx, query, args, func() error {
+		tx := getTransactionFromContext(ctx)
+		if tx == nil {
+			return d.PipeErr(d.readConnection().QueryRowContext(ctx, query, args...).Scan(dest))
+		}
+		return d.PipeErr(tx.QueryRowContext(ctx, query, args...).Scan(dest))
+	})
+}
+
 func (d *dal) DoSelect(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
 	return d.pipeQueryLog(ctx, query, args, func() error {
 		tx := getTransactionFromContext(ctx)
 		if tx == nil {
-			err := d.Connection().SelectContext(ctx, dest, query, args...)
+			err := d.readConnection().SelectContext(ctx, dest, query, args...)
 			return d.PipeErr(err)
 		}
 		err := tx.Select(dest, query, args...)
@@ -177,7 +424,53 @@ func (d *dal) DoSelect(ctx context.Context, dest interface{}, query string, args
 	})
 }
 
+// RowScanner scans the current row into a struct pointer (or a scannable value for single column rows)
+type RowScanner func(dest interface{}) error
+
+// DoSelectEach streams the rows one at a time to fn instead of loading the whole result,
+// iteration stops at the first fn error. The profiled duration spans the whole iteration.
+func (d *dal) DoSelectEach(ctx context.Context, fn func(scan RowScanner) error, query string, args ...interface{}) error {
+	return d.pipeQueryLog(ctx, query, args, func() error {
+		var rows *sqlx.Rows
+		var err error
+		if tx := getTransactionFromContext(ctx); tx != nil {
+			rows, err = tx.QueryxContext(ctx, query, args...)
+		} else {
+			rows, err = d.readConnection().QueryxContext(ctx, query, args...)
+		}
+		if err != nil {
+			return d.PipeErr(err)
+		}
+		defer rows.Close()
+		scan := func(dest interface{}) error {
+			return scanRow(rows, dest)
+		}
+		for rows.Next() {
+			if err := fn(scan); err != nil {
+				return err
+			}
+		}
+		return d.PipeErr(rows.Err())
+	})
+}
+
+// scanRow scans structs by column names and everything else (scalars, sql.Scanner, time) positionally
+func scanRow(rows *sqlx.Rows, dest interface{}) error {
+	switch dest.(type) {
+	case sql.Scanner, *time.Time:
+		return rows.Scan(dest)
+	}
+	if reflectx.Deref(reflect.TypeOf(dest)).Kind() == reflect.Struct {
+		return rows.StructScan(dest)
+	}
+	return rows.Scan(dest)
+}
+
 func (d *dal) Transactional(ctx context.Context, cb func(ctx context.Context) error) error {
+	if isDryRun(ctx) {
+		// nothing is executed, no connection needed
+		return cb(ctx)
+	}
 	return d.transactions.Run(ctx, cb)
 }
 
@@ -228,7 +521,7 @@ func (d *dal) DeleteE(ctx context.Context, table string, obj interface{}, where
 	return result, err
 }
 
-func (d *dal) FindBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pager Pagination) error {
+func (d *dal) FindBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pager Pagination, opts ...FindOptions) error {
 	value := reflect.ValueOf(dest)
 	if value.Kind() != reflect.Ptr {
 		return Wrap(fmt.Errorf("must pass a pointer to slice of stuct, not a value, to FindBy destination %T", dest))
@@ -245,10 +538,8 @@ func (d *dal) FindBy(ctx context.Context, tableName string, dest interface{}, co
 	if base.Kind() != reflect.Struct {
 		return Wrap(fmt.Errorf("must pass a pointer to slice of stuct, not a value, to FindBy destination %T", e))
 	}
-	args, expressions := d.ToArgsAndExpressions(cond)
-	query := d.SelectE(e.Interface()).
-		From(tableName).
-		Where(expressions...).
+	builder, args := d.findQuery(tableName, e.Interface(), cond, opts)
+	query := builder.
 		Limit(pager.Limit).
 		Offset(pager.Offset).
 		ToSQL()
@@ -256,7 +547,7 @@ func (d *dal) FindBy(ctx context.Context, tableName string, dest interface{}, co
 	return d.DoSelect(ctx, dest, query, args...)
 }
 
-func (d *dal) FindOneBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions) error {
+func (d *dal) FindOneBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, opts ...FindOptions) error {
 	v := reflect.ValueOf(dest)
 	if v.Kind() != reflect.Ptr {
 		return Wrap(fmt.Errorf("must pass a pointer to a stuct, %T", dest))
@@ -265,10 +556,8 @@ func (d *dal) FindOneBy(ctx context.Context, tableName string, dest interface{},
 	if e.Kind() != reflect.Struct {
 		return Wrap(fmt.Errorf("must pass a pointer to a stuct, %T", dest))
 	}
-	args, expressions := d.ToArgsAndExpressions(cond)
-	query := d.SelectE(dest).
-		From(tableName).
-		Where(expressions...).
+	builder, args := d.findQuery(tableName, dest, cond, opts)
+	query := builder.
 		Limit(1).
 		ToSQL()
 
@@ -276,16 +565,56 @@ func (d *dal) FindOneBy(ctx context.Context, tableName string, dest interface{},
 }
 
 func (d *dal) SoftDelete(ctx context.Context, tableName string, id uuid.UUID) error {
+	return d.SoftDeleteByKey(ctx, tableName, qbuilder.Conditions{"id": id})
+}
+
+// SoftDeleteByKey soft deletes the row identified by a (composite) key, e.g. {"user_id": u, "group_id": g}
+func (d *dal) SoftDeleteByKey(ctx context.Context, tableName string, key qbuilder.Conditions) error {
+	if len(key) == 0 {
+		return Wrap(ErrEmptyConditions)
+	}
+	args, expressions := d.ToArgsAndExpressions(key)
 	query := d.BuildUpdate(tableName).
 		Set("deleted_at", "now()").
-		Where("id = $1")
-	tx := getTransactionFromContext(ctx)
-	if tx == nil {
-		_, err := d.Connection().ExecContext(ctx, query.ToSQL(), id)
-		return d.PipeErr(err)
+		Where(expressions...)
+	_, err := d.DoExec(ctx, query.ToSQL(), args...)
+	return err
+}
+
+// BulkGuard unlocks bulk writes with empty conditions, which would affect the whole table
+type BulkGuard bool
+
+const AllowAllRows BulkGuard = true
+
+var ErrEmptyConditions = errors.New("refusing to affect all rows with empty conditions, pass AllowAllRows")
+
+func allowAllRows(guard []BulkGuard) bool {
+	return len(guard) > 0 && bool(guard[0])
+}
+
+// SoftDeleteWhere sets deleted_at on all not yet deleted rows matching cond, returns the number of affected rows.
+// Empty conditions fail with ErrEmptyConditions unless AllowAllRows is passed.
+func (d *dal) SoftDeleteWhere(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error) {
+	if len(cond) == 0 && !allowAllRows(guard) {
+		return 0, Wrap(ErrEmptyConditions)
 	}
-	_, err := tx.ExecContext(ctx, query.ToSQL(), id)
-	return d.PipeErr(err)
+	args, expressions := d.ToArgsAndExpressions(cond)
+	query := d.BuildUpdate(tableName).
+		Set("deleted_at", "now()").
+		Where(append(expressions, "deleted_at IS NULL")...)
+	return AffectedRows(d.DoExec(ctx, query.ToSQL(), args...))
+}
+
+// Delete removes all rows matching cond, returns the number of affected rows.
+// Empty conditions fail with ErrEmptyConditions unless AllowAllRows is passed.
+func (d *dal) Delete(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error) {
+	if len(cond) == 0 && !allowAllRows(guard) {
+		return 0, Wrap(ErrEmptyConditions)
+	}
+	args, expressions := d.ToArgsAndExpressions(cond)
+	query := d.BuildDelete(tableName).
+		Where(expressions...)
+	return AffectedRows(d.DoExec(ctx, query.ToSQL(), args...))
 }
 
 type TransactionManagerConfig struct {
@@ -334,7 +663,12 @@ func (m *transactions) Run(ctx context.Context, callback func(ctx context.Contex
 		}
 	}()
 
-	if err := callback(m.putTransactionToContext(ctx, transaction)); err != nil {
+	txCtx := m.putTransactionToContext(ctx, transaction)
+	if err := callback(txCtx); err != nil {
+		return multierr.Combine(err, transaction.rollback())
+	}
+
+	if err := transaction.beforeCommit(txCtx); err != nil {
 		return multierr.Combine(err, transaction.rollback())
 	}
 
@@ -351,7 +685,7 @@ func (m *transactions) putTransactionToContext(ctx context.Context, tx *transact
 
 func (m *transactions) beginTransaction(ctx context.Context) (*transaction, error) {
 	if t := extractTransactionFromContext(ctx); t != nil {
-		return &transaction{tx: t.tx, depth: t.depth + 1}, nil
+		return &transaction{tx: t.tx, depth: t.depth + 1, hooks: t.hooks}, nil
 	}
 
 	return m.beginNewTransaction(ctx)
@@ -363,12 +697,22 @@ func (m *transactions) beginNewTransaction(ctx context.Context) (*transaction, e
 		return nil, errors.WithStack(err)
 	}
 
-	return &transaction{tx: sqlxTx, depth: 0}, nil
+	return &transaction{tx: sqlxTx, depth: 0, hooks: &txHooks{}}, nil
 }
 
 type transaction struct {
 	tx    *sqlx.Tx
 	depth uint
+	// hooks shared by the nested blocks, resolved by the outermost one
+	hooks *txHooks
+}
+
+func (t *transaction) beforeCommit(ctx context.Context) error {
+	if t.depth != 0 {
+		return nil
+	}
+
+	return t.hooks.runBeforeCommit(ctx)
 }
 
 func (t *transaction) commit() error {
@@ -376,7 +720,11 @@ func (t *transaction) commit() error {
 		return nil
 	}
 
-	return t.tx.Commit()
+	if err := t.tx.Commit(); err != nil {
+		return err
+	}
+	t.hooks.runAfterCommit()
+	return nil
 }
 
 func (t *transaction) rollback() error {
@@ -384,7 +732,9 @@ func (t *transaction) rollback() error {
 		return nil
 	}
 
-	return t.tx.Rollback()
+	err := t.tx.Rollback()
+	t.hooks.runAfterRollback()
+	return err
 }
 
 func extractTransactionFromContext(ctx context.Context) *transaction {
@@ -395,21 +745,46 @@ func extractTransactionFromContext(ctx context.Context) *transaction {
 	return nil
 }
 
+// ToArgsAndExpressions builds equality expressions, nil values produce IS NULL
+// and plain slices match any of their elements (col = ANY($n))
 func (d *dal) ToArgsAndExpressions(conditions map[string]interface{}) ([]interface{}, []string) {
 	var args []interface{}
 	var expressions []string
 
-	for field, value := range conditions {
+	// sorted for the query text and the args order to be stable, e.g. for query cache keys
+	fields := make([]string, 0, len(conditions))
+	for field := range conditions {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		value := conditions[field]
 		if value == nil {
 			expressions = append(expressions, fmt.Sprintf("%s IS NULL", field))
+		} else if isArrayArg(value) {
+			var expression string
+			args, expression = d.dialect.inExpression(field, value, args)
+			expressions = append(expressions, expression)
 		} else {
 			args = append(args, value)
-			expressions = append(expressions, fmt.Sprintf("%s = $%d", field, len(args)))
+			expressions = append(expressions, fmt.Sprintf("%s = %s", field, d.dialect.Placeholder(len(args))))
 		}
 	}
 	return args, expressions
 }
 
+// AffectedRows unwraps the number of affected rows from Do* results
+func AffectedRows(result sql.Result, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, Wrap(err)
+	}
+	return affected, nil
+}
+
 func (d *dal) PipeErr(err error) error {
 	return HandleError(err)
 }
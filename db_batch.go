@@ -0,0 +1,202 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Batch buffers write statements and executes them in a single round trip on Flush.
+// With Postgres the statements are combined into one statement of data-modifying CTEs, so they run
+// on the same snapshot: a queued statement does not see the rows written by another one of the batch,
+// flush first when it has to (e.g. updating a row inserted by the batch). Children referencing the parent
+// by foreign key are fine, constraints are checked at the end of the statement.
+// Other dialects execute the statements one by one.
+type Batch interface {
+	// Queue a statement with positional args ($1... numbered per statement)
+	Queue(query string, args ...interface{})
+	// QueueNamed a statement with :name args bound from arg, like DoExecNamed
+	QueueNamed(query string, arg interface{}) error
+	// QueueInsert a named insert of entity, timestamps are stamped like DoInsert
+	QueueInsert(query string, entity interface{}) error
+	Len() int
+	// Flush executes and clears the queued statements
+	Flush(ctx context.Context) error
+}
+
+type queuedStatement struct {
+	query string
+	args  []interface{}
+}
+
+type batch struct {
+	dal        *dal
+	mu         sync.Mutex
+	statements []queuedStatement
+}
+
+// Batch returns a batch flushed automatically right before the commit of the transaction in ctx,
+// without a transaction Flush has to be called
+func (d *dal) Batch(ctx context.Context) Batch {
+	b := &batch{dal: d}
+	if extractTransactionFromContext(ctx) != nil {
+		_ = RegisterBeforeCommit(ctx, b.Flush)
+	}
+	return b
+}
+
+func (b *batch) Queue(query string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statements = append(b.statements, queuedStatement{query: query, args: args})
+}
+
+func (b *batch) QueueNamed(query string, arg interface{}) error {
+	bound, args, err := sqlx.Named(query, arg)
+	if err != nil {
+		return Wrap(err)
+	}
+	b.Queue(b.dal.Connection().Rebind(bound), args...)
+	return nil
+}
+
+func (b *batch) QueueInsert(query string, entity interface{}) error {
+	if b.dal.autoTimestamps {
+		stampTimestamps(entity, ColumnCreatedAt, ColumnUpdatedAt)
+	}
+	return b.QueueNamed(query, entity)
+}
+
+func (b *batch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.statements)
+}
+
+func (b *batch) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	statements := b.statements
+	b.statements = nil
+	b.mu.Unlock()
+	if len(statements) == 0 {
+		return nil
+	}
+	if len(statements) == 1 || b.dal.dialect != DialectPostgres {
+		for _, s := range statements {
+			if _, err := b.dal.DoExec(ctx, s.query, s.args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	query, args := combineStatements(statements)
+	_, err := b.dal.DoExec(ctx, query, args...)
+	return err
+}
+
+// combineStatements renumbers the placeholders of every statement after the args of the previous ones:
+// WITH batch_1 AS (INSERT ... $1), batch_2 AS (INSERT ... $2) SELECT 1
+func combineStatements(statements []queuedStatement) (string, []interface{}) {
+	var args []interface{}
+	ctes := make([]string, 0, len(statements))
+	for i, s := range statements {
+		query := renumberPlaceholders(strings.TrimRight(strings.TrimSpace(s.query), ";"), len(args))
+		ctes = append(ctes, fmt.Sprintf("batch_%d AS (%s)", i+1, query))
+		args = append(args, s.args...)
+	}
+	return fmt.Sprintf("WITH %s SELECT 1", strings.Join(ctes, ", ")), args
+}
+
+// renumberPlaceholders shifts the $N placeholders by offset, leaving literals, quoted identifiers,
+// dollar-quoted strings, comments and identifiers containing $ untouched
+func renumberPlaceholders(query string, offset int) string {
+	var out strings.Builder
+	out.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			end := skipQuoted(query, i, c)
+			out.WriteString(query[i:end])
+			i = end
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				end = len(query) - i
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				end = len(query) - i
+			} else {
+				end += 4
+			}
+			out.WriteString(query[i : i+end])
+			i += end
+		case c == '$' && (i == 0 || !isIdentChar(query[i-1])):
+			j := i + 1
+			for j < len(query) && query[j] >= '0' && query[j] <= '9' {
+				j++
+			}
+			if j > i+1 {
+				n, _ := strconv.Atoi(query[i+1 : j])
+				out.WriteString(fmt.Sprintf("$%d", n+offset))
+				i = j
+				continue
+			}
+			if end, ok := skipDollarQuoted(query, i); ok {
+				out.WriteString(query[i:end])
+				i = end
+				continue
+			}
+			out.WriteByte(c)
+			i++
+		default:
+			out.WriteByte(c)
+			i++
+		}
+	}
+	return out.String()
+}
+
+// skipQuoted returns the index after the literal or identifier opened at start, doubled quotes escape
+func skipQuoted(query string, start int, quote byte) int {
+	for i := start + 1; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+// skipDollarQuoted returns the index after the $tag$...$tag$ string opened at start
+func skipDollarQuoted(query string, start int) (int, bool) {
+	j := start + 1
+	for j < len(query) && query[j] != '$' && isIdentChar(query[j]) {
+		j++
+	}
+	if j >= len(query) || query[j] != '$' {
+		return 0, false
+	}
+	tag := query[start : j+1]
+	end := strings.Index(query[j+1:], tag)
+	if end < 0 {
+		return len(query), true
+	}
+	return j + 1 + end + len(tag), true
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
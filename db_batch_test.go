@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestRenumberPlaceholders(t *testing.T) {
+	cases := []struct {
+		query    string
+		expected string
+	}{
+		{"INSERT INTO t (a, b) VALUES ($1, $2)", "INSERT INTO t (a, b) VALUES ($3, $4)"},
+		{"UPDATE t SET a = '$1 costs $2', b = $1", "UPDATE t SET a = '$1 costs $2', b = $3"},
+		{"UPDATE t SET a = 'it''s $1' WHERE id = $1", "UPDATE t SET a = 'it''s $1' WHERE id = $3"},
+		{`UPDATE "col$1" SET a = $1`, `UPDATE "col$1" SET a = $3`},
+		{"UPDATE t SET body = $$ $1 $$, b = $1", "UPDATE t SET body = $$ $1 $$, b = $3"},
+		{"UPDATE t SET body = $fn$ $1 $fn$, b = $1", "UPDATE t SET body = $fn$ $1 $fn$, b = $3"},
+		{"UPDATE tab$1 SET a = $1 -- $2\nWHERE b = $2 /* $1 */", "UPDATE tab$1 SET a = $3 -- $2\nWHERE b = $4 /* $1 */"},
+	}
+	for _, c := range cases {
+		if actual := renumberPlaceholders(c.query, 2); actual != c.expected {
+			t.Errorf("renumberPlaceholders(%q) = %q, expected %q", c.query, actual, c.expected)
+		}
+	}
+}
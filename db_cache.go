@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// QueryCache stores serialized query results, keys start with the query string
+type QueryCache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration)
+	DeletePrefix(prefix string)
+}
+
+// DoSelectCached read-through cached DoSelect, results are kept as JSON for ttl keyed by the query and its args.
+// Cache hits fill dest by unmarshaling that JSON rather than scanning rows, so dest must round-trip:
+// json tags apply instead of db ones, unexported fields are lost and interface{} numbers come back as float64.
+// Inside a transaction the cache is bypassed so a unit of work always reads its own writes.
+func (d *dal) DoSelectCached(ctx context.Context, ttl time.Duration, dest interface{}, query string, args ...interface{}) error {
+	if getTransactionFromContext(ctx) != nil || isDryRun(ctx) {
+		return d.DoSelect(ctx, dest, query, args...)
+	}
+	key, err := queryCacheKey(query, args)
+	if err != nil {
+		return Wrap(err)
+	}
+	if cached, ok := d.queryCache.Get(key); ok {
+		if err := json.Unmarshal(cached, dest); err == nil {
+			return nil
+		}
+	}
+	if err := d.DoSelect(ctx, dest, query, args...); err != nil {
+		return err
+	}
+	marshaled, err := json.Marshal(dest)
+	if err != nil {
+		LoggerFromContext(ctx).Warn(fmt.Sprintf("query cache: %s", err))
+		return nil
+	}
+	d.queryCache.Set(key, marshaled, ttl)
+	return nil
+}
+
+// InvalidateQueryCache drops the cached results of the queries starting with prefix, empty prefix drops all
+func (d *dal) InvalidateQueryCache(prefix string) {
+	d.queryCache.DeletePrefix(prefix)
+}
+
+func queryCacheKey(query string, args []interface{}) (string, error) {
+	marshaled, err := json.Marshal(args)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s\x00%s", query, marshaled), nil
+}
+
+type memoryQueryCacheEntry struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// queryCacheSweepInterval how often Set drops the expired entries of the memory cache
+const queryCacheSweepInterval = time.Minute
+
+type memoryQueryCache struct {
+	mu        sync.RWMutex
+	entries   map[string]memoryQueryCacheEntry
+	lastSweep time.Time
+}
+
+func NewMemoryQueryCache() QueryCache {
+	return &memoryQueryCache{entries: make(map[string]memoryQueryCacheEntry)}
+}
+
+func (c *memoryQueryCache) Get(key string) ([]byte, bool) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return nil, false
+	}
+	if time.Now().After(entry.expiresAt) {
+		c.mu.Lock()
+		if current, ok := c.entries[key]; ok && time.Now().After(current.expiresAt) {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *memoryQueryCache) Set(key string, value []byte, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if now.Sub(c.lastSweep) >= queryCacheSweepInterval {
+		c.lastSweep = now
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = memoryQueryCacheEntry{value: value, expiresAt: now.Add(ttl)}
+}
+
+func (c *memoryQueryCache) DeletePrefix(prefix string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k := range c.entries {
+		if strings.HasPrefix(k, prefix) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"reflect"
+
+	"github.com/slmder/qbuilder"
+)
+
+// dalTagNull includes a nil pointer field of a filter struct as IS NULL, e.g.
+//
+//	DeletedAt *time.Time `db:"deleted_at" dal:"null"`
+const dalTagNull = "null"
+
+// ConditionsFromStruct builds FindBy conditions from the db tagged fields of a filter struct (or pointer to one).
+// Zero value fields are skipped, non nil pointers are always included (even pointing to a zero value),
+// nil pointers tagged `dal:"null"` produce IS NULL and slices match any of their elements.
+func ConditionsFromStruct(filter interface{}) qbuilder.Conditions {
+	cond := qbuilder.Conditions{}
+	v := reflect.ValueOf(filter)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return cond
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return cond
+	}
+	collectConditions(v, cond)
+	return cond
+}
+
+func collectConditions(v reflect.Value, cond qbuilder.Conditions) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			collectConditions(fv, cond)
+			continue
+		}
+		column := field.Tag.Get("db")
+		if column == "" || column == "-" || !field.IsExported() {
+			continue
+		}
+		switch {
+		case fv.Kind() == reflect.Ptr:
+			if !fv.IsNil() {
+				cond[column] = fv.Elem().Interface()
+			} else if field.Tag.Get(dalTagName) == dalTagNull {
+				cond[column] = nil
+			}
+		case fv.Kind() == reflect.Slice:
+			if fv.Len() > 0 {
+				cond[column] = fv.Interface()
+			}
+		case !fv.IsZero():
+			cond[column] = fv.Interface()
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// Dialect controls the placeholders of the queries built by the DAL helpers
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+)
+
+// Placeholder n-th (1 based) positional placeholder
+func (d Dialect) Placeholder(n int) string {
+	if d == DialectMySQL {
+		return "?"
+	}
+	return fmt.Sprintf("$%d", n)
+}
+
+// inExpression equality against any of the slice elements,
+// postgres binds the whole slice as an array, mysql expands it into an IN list
+func (d Dialect) inExpression(field string, value interface{}, args []interface{}) ([]interface{}, string) {
+	if d != DialectMySQL {
+		// the pq array types are bound as they are
+		if _, ok := value.(driver.Valuer); !ok {
+			value = pq.Array(value)
+		}
+		args = append(args, value)
+		return args, fmt.Sprintf("%s = ANY(%s)", field, d.Placeholder(len(args)))
+	}
+	if generic, ok := value.(pq.GenericArray); ok {
+		value = generic.A
+	}
+	slice := reflect.Indirect(reflect.ValueOf(value))
+	if slice.Len() == 0 {
+		return args, "1 = 0"
+	}
+	placeholders := make([]string, slice.Len())
+	for i := 0; i < slice.Len(); i++ {
+		args = append(args, slice.Index(i).Interface())
+		placeholders[i] = d.Placeholder(len(args))
+	}
+	return args, fmt.Sprintf("%s IN (%s)", field, strings.Join(placeholders, ", "))
+}
+
+// dialectOf the dialect of the DAL, DialectPostgres for Dal implementations not exposing one
+func dialectOf(d Dal) Dialect {
+	switch v := d.(type) {
+	case *dal:
+		return v.dialect
+	case *MockDal:
+		if v.Dialect != "" {
+			return v.Dialect
+		}
+	}
+	return DialectPostgres
+}
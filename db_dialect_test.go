@@ -0,0 +1,33 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+func TestInExpressionArrayValuers(t *testing.T) {
+	for _, value := range []interface{}{
+		pq.StringArray{"a", "b"},
+		pq.Int64Array{1, 2},
+		UUIDArray{uuid.New(), uuid.New()},
+		[]uuid.UUID{uuid.New(), uuid.New()},
+		[]string{"a", "b"},
+	} {
+		if !isArrayArg(value) {
+			t.Fatalf("expected %T to be an array arg", value)
+		}
+		_, postgres := DialectPostgres.inExpression("col", value, nil)
+		if postgres != "col = ANY($1)" {
+			t.Errorf("expected postgres ANY expression for %T, got %s", value, postgres)
+		}
+		args, mysql := DialectMySQL.inExpression("col", value, nil)
+		if mysql != "col IN (?, ?)" || len(args) != 2 {
+			t.Errorf("expected mysql IN list for %T, got %s %v", value, mysql, args)
+		}
+	}
+	if isArrayArg([]byte("a")) {
+		t.Error("expected byte slices not to be array args")
+	}
+}
@@ -0,0 +1,47 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+var selectQueryRe = regexp.MustCompile(`(?is)^\s*(\(\s*)*(select|with)\b`)
+
+const explainSavepoint = "core_explain"
+
+// explain plans a select issued with the given args, without ANALYZE so the query is not executed again.
+// Within a transaction it runs on the transaction so it sees the same rows and temporary tables,
+// inside a savepoint rolled back on error so a failing EXPLAIN does not abort the transaction.
+// It runs straight on the connection so it is never profiled itself.
+func (d *dal) explain(ctx context.Context, query string, args []interface{}) json.RawMessage {
+	if d.dialect != DialectPostgres || !selectQueryRe.MatchString(query) {
+		return nil
+	}
+	explainQuery := fmt.Sprintf("EXPLAIN (FORMAT JSON) %s", query)
+	var plan []byte
+	tx := extractTransactionFromContext(ctx)
+	if tx == nil {
+		if err := d.readConnection().QueryRowxContext(ctx, explainQuery, args...).Scan(&plan); err != nil {
+			LoggerFromContext(ctx).Debug(fmt.Sprintf("explain: %s", err))
+			return nil
+		}
+		return plan
+	}
+	if _, err := tx.tx.ExecContext(ctx, "SAVEPOINT "+explainSavepoint); err != nil {
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("explain: %s", err))
+		return nil
+	}
+	if err := tx.tx.QueryRowxContext(ctx, explainQuery, args...).Scan(&plan); err != nil {
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("explain: %s", err))
+		if _, err := tx.tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT "+explainSavepoint); err != nil {
+			LoggerFromContext(ctx).Error(fmt.Sprintf("explain: %s", err))
+		}
+		return nil
+	}
+	if _, err := tx.tx.ExecContext(ctx, "RELEASE SAVEPOINT "+explainSavepoint); err != nil {
+		LoggerFromContext(ctx).Debug(fmt.Sprintf("explain: %s", err))
+	}
+	return plan
+}
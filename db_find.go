@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/slmder/qbuilder"
+)
+
+type JoinType string
+
+const (
+	JoinInner JoinType = "INNER"
+	JoinLeft  JoinType = "LEFT"
+	JoinRight JoinType = "RIGHT"
+)
+
+type Join struct {
+	// Type defaults to JoinInner
+	Type  JoinType
+	Table string
+	Alias string
+	On    string
+}
+
+// FindOptions extends the FindBy/FindOneBy queries.
+// When joining, the select list is qualified with Alias (the table name by default)
+// and condition columns must be qualified as well to avoid ambiguity, e.g. "o.customer_id".
+// Clauses are assembled by qbuilder in WHERE, GROUP BY, HAVING, ORDER BY, LIMIT order.
+type FindOptions struct {
+	Alias    string
+	Joins    []Join
+	Distinct bool
+	GroupBy  []string
+	// Having expressions are AND-ed, placeholders continue after the conditions ($n+1...) and bind Args
+	Having []string
+	Args   []interface{}
+}
+
+func (d *dal) findQuery(tableName string, dest interface{}, cond qbuilder.Conditions, opts []FindOptions) (*qbuilder.SelectBuilder, []interface{}) {
+	var opt FindOptions
+	if len(opts) > 0 {
+		opt = opts[0]
+	}
+	alias := opt.Alias
+	if alias == "" && len(opt.Joins) > 0 {
+		alias = tableName
+	}
+	args, expressions := d.ToArgsAndExpressions(cond)
+	builder := d.SelectE(dest, alias).From(tableName)
+	if opt.Distinct {
+		builder.Select(fmt.Sprintf("DISTINCT %s", qbuilder.SelectList(dest, alias)))
+	}
+	for _, join := range opt.Joins {
+		switch join.Type {
+		case JoinLeft:
+			builder.LeftJoin(join.Table, join.Alias, join.On)
+		case JoinRight:
+			builder.RightJoin(join.Table, join.Alias, join.On)
+		default:
+			builder.InnerJoin(join.Table, join.Alias, join.On)
+		}
+	}
+	// AddGroupBy of qbuilder replaces the previous expression, hence the single joined one
+	if len(opt.GroupBy) > 0 {
+		builder.GroupBy(strings.Join(opt.GroupBy, ", "))
+	}
+	if len(opt.Having) > 0 {
+		builder.Having(strings.Join(opt.Having, " AND "))
+	}
+	return builder.Where(expressions...), append(args, opt.Args...)
+}
+
+// FindByPaged FindBy returning the total number of rows matching the conditions regardless of pagination,
+// the count wraps the unpaginated query so DISTINCT and GROUP BY are counted as rows
+func (d *dal) FindByPaged(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pager Pagination, opts ...FindOptions) (uint64, error) {
+	if err := d.FindBy(ctx, tableName, dest, cond, pager, opts...); err != nil {
+		return 0, err
+	}
+	builder, args := d.findQuery(tableName, reflect.Indirect(reflect.ValueOf(dest)).Interface(), cond, opts)
+	var total uint64
+	query := fmt.Sprintf("SELECT COUNT(*) FROM (%s) AS paged", builder.ToSQL())
+	if err := d.DoSelectScalar(ctx, &total, query, args...); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// FindByCursor keyset pagination, selects up to limit rows ordered by cursorCol with cursorCol > after
+// (the first page when after is nil). Prefix the column with "-" for descending order (cursorCol < after).
+// The cursor column value of the last row is returned as the next cursor, nil when there are no more rows.
+// cursorCol should be unique (e.g. the primary key) for rows not to be skipped.
+func (d *dal) FindByCursor(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, cursorCol string, after interface{}, limit uint32, opts ...FindOptions) (interface{}, error) {
+	value := reflect.ValueOf(dest)
+	if value.Kind() != reflect.Ptr || value.IsNil() || value.Elem().Kind() != reflect.Slice {
+		return nil, Wrap(fmt.Errorf("must pass a pointer to slice of stuct, not a value, to FindByCursor destination %T", dest))
+	}
+	column, direction, operator := cursorCol, qbuilder.SortDirectionASC, ">"
+	if strings.HasPrefix(cursorCol, "-") {
+		column, direction, operator = strings.TrimPrefix(cursorCol, "-"), qbuilder.SortDirectionDESC, "<"
+	}
+	builder, args := d.findQuery(tableName, value.Elem().Interface(), cond, opts)
+	if after != nil {
+		args = appendCursorArg(d.dialect, args, after, opts)
+		builder.AndWhere(fmt.Sprintf("%s %s %s", column, operator, d.dialect.Placeholder(len(args))))
+	}
+	query := builder.
+		AddOrderBy(column, direction).
+		Limit(limit).
+		ToSQL()
+	if err := d.DoSelect(ctx, dest, query, args...); err != nil {
+		return nil, err
+	}
+	rows := value.Elem()
+	if rows.Len() == 0 || (limit > 0 && uint32(rows.Len()) < limit) {
+		return nil, nil
+	}
+	return cursorValue(rows.Index(rows.Len()-1), column)
+}
+
+// appendCursorArg binds the cursor after the condition args: numbered placeholders keep the Having ones
+// at $n+1..., positional mysql ones bind in WHERE, HAVING order so the cursor goes before the Having args
+func appendCursorArg(dialect Dialect, args []interface{}, after interface{}, opts []FindOptions) []interface{} {
+	if dialect != DialectMySQL || len(opts) == 0 || len(opts[0].Args) == 0 {
+		return append(args, after)
+	}
+	conditions := len(args) - len(opts[0].Args)
+	bound := make([]interface{}, 0, len(args)+1)
+	bound = append(bound, args[:conditions]...)
+	bound = append(bound, after)
+	return append(bound, args[conditions:]...)
+}
+
+// cursorValue reads the db tagged field of the column (unqualified) from a row
+func cursorValue(row reflect.Value, column string) (interface{}, error) {
+	row = reflect.Indirect(row)
+	if i := strings.LastIndexByte(column, '.'); i >= 0 {
+		column = column[i+1:]
+	}
+	if row.Kind() == reflect.Struct {
+		if field, ok := findColumnField(row, column); ok {
+			return field.Interface(), nil
+		}
+	}
+	return nil, Wrap(fmt.Errorf("no field tagged `db:\"%s\"` in %s", column, row.Type()))
+}
+
+func findColumnField(v reflect.Value, column string) (reflect.Value, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			if f, ok := findColumnField(fv, column); ok {
+				return f, true
+			}
+			continue
+		}
+		if field.Tag.Get("db") == column {
+			return fv, true
+		}
+	}
+	return reflect.Value{}, false
+}
@@ -0,0 +1,20 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppendCursorArg(t *testing.T) {
+	opts := []FindOptions{{Having: []string{"COUNT(*) > ?"}, Args: []interface{}{"having"}}}
+	args := []interface{}{"condition", "having"}
+
+	mysql := appendCursorArg(DialectMySQL, args, "cursor", opts)
+	if expected := []interface{}{"condition", "cursor", "having"}; !reflect.DeepEqual(mysql, expected) {
+		t.Errorf("expected mysql args %v, got %v", expected, mysql)
+	}
+	postgres := appendCursorArg(DialectPostgres, args, "cursor", opts)
+	if expected := []interface{}{"condition", "having", "cursor"}; !reflect.DeepEqual(postgres, expected) {
+		t.Errorf("expected postgres args %v, got %v", expected, postgres)
+	}
+}
@@ -0,0 +1,210 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// FixtureTable rows to be inserted into a table, tables listed in DependsOn are loaded first.
+// Fixture files (.json, .yml, .yaml) hold a list of tables:
+//
+//	[{table: users, rows: [{id: 1, username: admin}]},
+//	 {table: orders, depends_on: [users], rows: [{id: 1, user_id: 1}]}]
+type FixtureTable struct {
+	Table     string                   `json:"table" yaml:"table"`
+	DependsOn []string                 `json:"depends_on" yaml:"depends_on"`
+	Rows      []map[string]interface{} `json:"rows" yaml:"rows"`
+}
+
+type Fixtures interface {
+	// Load reads fixture files and loads them within a single transaction
+	Load(ctx context.Context, files ...string) error
+	LoadTables(ctx context.Context, tables []FixtureTable) error
+}
+
+type FixturesOptions struct {
+	// Truncate empties the fixture tables before loading
+	Truncate bool
+	// Cascade also truncates every table referencing the fixture tables,
+	// without it Postgres refuses to truncate tables referenced by unlisted ones
+	Cascade bool
+}
+
+type fixtures struct {
+	dal  Dal
+	opts FixturesOptions
+}
+
+// NewFixtures creates the loader, truncate empties the fixture tables before loading
+func NewFixtures(dal Dal, truncate bool) Fixtures {
+	return NewFixturesWithOptions(dal, FixturesOptions{Truncate: truncate})
+}
+
+func NewFixturesWithOptions(dal Dal, opts FixturesOptions) Fixtures {
+	return &fixtures{dal: dal, opts: opts}
+}
+
+func (f *fixtures) Load(ctx context.Context, files ...string) error {
+	var tables []FixtureTable
+	for _, file := range files {
+		loaded, err := readFixtureFile(file)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, loaded...)
+	}
+	return f.LoadTables(ctx, tables)
+}
+
+func (f *fixtures) LoadTables(ctx context.Context, tables []FixtureTable) error {
+	ordered, err := orderFixtureTables(tables)
+	if err != nil {
+		return err
+	}
+	return f.dal.Transactional(ctx, func(ctx context.Context) error {
+		if f.opts.Truncate && len(ordered) > 0 {
+			names := make([]string, 0, len(ordered))
+			for _, t := range ordered {
+				if !StringsContains(names, t.Table) {
+					names = append(names, t.Table)
+				}
+			}
+			query := fmt.Sprintf("TRUNCATE %s", strings.Join(names, ", "))
+			if f.opts.Cascade {
+				query += " CASCADE"
+			}
+			if _, err := f.dal.DoExec(ctx, query); err != nil {
+				return err
+			}
+		}
+		for _, t := range ordered {
+			for _, row := range t.Rows {
+				if err := f.insertRow(ctx, t.Table, row); err != nil {
+					return fmt.Errorf("fixture %s: %w", t.Table, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (f *fixtures) insertRow(ctx context.Context, table string, row map[string]interface{}) error {
+	columns := make(map[string]string, len(row))
+	args := make(map[string]interface{}, len(row))
+	for column, value := range row {
+		columns[column] = fmt.Sprintf(":%s", column)
+		arg, err := fixtureArg(value)
+		if err != nil {
+			return err
+		}
+		args[column] = arg
+	}
+	_, err := f.dal.DoInsert(ctx, f.dal.BuildInsert(table).Row(columns).ToSQL(), args)
+	return err
+}
+
+// fixtureArg binds lists as arrays and nested objects as json
+func fixtureArg(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return json.Marshal(v)
+	case []interface{}:
+		return pq.Array(v), nil
+	}
+	return value, nil
+}
+
+func readFixtureFile(file string) ([]FixtureTable, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var tables []FixtureTable
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(content, &tables)
+	case ".json":
+		err = json.Unmarshal(content, &tables)
+	default:
+		return nil, fmt.Errorf("unsupported fixture file %s", file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fixture file %s: %w", file, err)
+	}
+	return tables, nil
+}
+
+// orderFixtureTables sorts tables so that dependencies come first, keeping the given order otherwise
+func orderFixtureTables(tables []FixtureTable) ([]FixtureTable, error) {
+	byName := make(map[string][]FixtureTable)
+	var names []string
+	for _, t := range tables {
+		if _, ok := byName[t.Table]; !ok {
+			names = append(names, t.Table)
+		}
+		byName[t.Table] = append(byName[t.Table], t)
+	}
+	state := make(map[string]int)
+	var ordered []FixtureTable
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case 1:
+			return fmt.Errorf("fixture dependency cycle: %s", strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		state[name] = 1
+		for _, t := range byName[name] {
+			for _, dep := range t.DependsOn {
+				if _, ok := byName[dep]; !ok {
+					continue
+				}
+				if err := visit(dep, append(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		state[name] = 2
+		ordered = append(ordered, byName[name]...)
+		return nil
+	}
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return ordered, nil
+}
+
+// FixtureCommands returns the `fixtures load <files...>` command
+func FixtureCommands(f Fixtures) Commands {
+	return Commands{
+		{
+			Use:   "fixtures",
+			Short: "Database fixtures",
+			Children: Commands{
+				{
+					Use:   "load <files...>",
+					Short: "Load fixture files",
+					Args:  cobra.MinimumNArgs(1),
+					Run: func(cmd *cobra.Command, args []string) {
+						if err := f.Load(CommandContext(cmd), args...); err != nil {
+							GetLogger().Error("fixtures load failed", Fields{"error": err.Error()})
+							os.Exit(1)
+						}
+						cmd.Printf("loaded %d fixture files\n", len(args))
+					},
+				},
+			},
+		},
+	}
+}
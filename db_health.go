@@ -0,0 +1,123 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	DefaultHealthCheckInterval = 5 * time.Second
+	DefaultHealthCheckTimeout  = 2 * time.Second
+)
+
+type HealthMonitorConfig struct {
+	// Interval between pings, DefaultHealthCheckInterval by default
+	Interval time.Duration
+	// Timeout of a single ping, DefaultHealthCheckTimeout by default
+	Timeout time.Duration
+}
+
+// HealthMonitor pings the database in the background and keeps the last known state,
+// so readiness probes are answered without a round trip to the database
+type HealthMonitor interface {
+	// Run pings until ctx is done, transitions between healthy and unhealthy are logged
+	Run(ctx context.Context) error
+	// Check pings immediately and updates the state
+	Check(ctx context.Context) error
+	Healthy() bool
+	// Err of the last ping, nil when healthy
+	Err() error
+}
+
+type healthMonitor struct {
+	dal    Dal
+	config HealthMonitorConfig
+	mu     sync.RWMutex
+	// err is nil while healthy, checked is false until the first ping
+	err     error
+	checked bool
+}
+
+func NewHealthMonitor(dal Dal, config ...HealthMonitorConfig) HealthMonitor {
+	var cfg HealthMonitorConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultHealthCheckInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultHealthCheckTimeout
+	}
+	return &healthMonitor{dal: dal, config: cfg}
+}
+
+func (h *healthMonitor) Run(ctx context.Context) error {
+	ticker := time.NewTicker(h.config.Interval)
+	defer ticker.Stop()
+	for {
+		_ = h.Check(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *healthMonitor) Check(ctx context.Context) error {
+	pingCtx, cancel := context.WithTimeout(ctx, h.config.Timeout)
+	defer cancel()
+	err := h.dal.Ping(pingCtx)
+	if ctx.Err() != nil {
+		// shutting down, not a database failure
+		return err
+	}
+	h.mu.Lock()
+	wasHealthy := h.err == nil
+	h.err, h.checked = err, true
+	h.mu.Unlock()
+	switch {
+	case err != nil && wasHealthy:
+		LoggerFromContext(ctx).Error(fmt.Sprintf("database is unhealthy: %s", err))
+	case err == nil && !wasHealthy:
+		LoggerFromContext(ctx).Info("database connection restored")
+	}
+	return err
+}
+
+func (h *healthMonitor) Healthy() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.checked && h.err == nil
+}
+
+func (h *healthMonitor) Err() error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if !h.checked {
+		return fmt.Errorf("database health is not checked yet")
+	}
+	return h.err
+}
+
+// NewReadyRoute answers 200 once every monitor is healthy and 503 otherwise, e.g. for kubernetes readiness probes
+func NewReadyRoute(path string, monitors ...HealthMonitor) Route {
+	return Route{
+		Path:   path,
+		Method: Get,
+		Handler: func(req Request) Response {
+			for _, monitor := range monitors {
+				if err := monitor.Err(); err != nil {
+					req.Logger().Debug("not ready", Fields{"error": err.Error()})
+					return NewErrorJSONResponse(ServiceUnavailableErr())
+				}
+			}
+			return NewJsonResponse(map[string]string{"status": "ready"}, fasthttp.StatusOK, nil)
+		},
+	}
+}
@@ -0,0 +1,284 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const MigrationsTable = "schema_migrations"
+
+// migration files are named <version>_<name>.up.sql and <version>_<name>.down.sql
+var migrationFileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version uint64
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   uint64     `db:"version"`
+	Name      string     `db:"-"`
+	AppliedAt *time.Time `db:"applied_at"`
+}
+
+func (s MigrationStatus) Applied() bool {
+	return s.AppliedAt != nil
+}
+
+type Migrations interface {
+	// Up applies all pending migrations in version order, concurrent runs apply each of them once
+	Up(ctx context.Context) ([]Migration, error)
+	// Down rolls back the given number of the most recently applied migrations,
+	// it stops at a migration without a down file
+	Down(ctx context.Context, steps int) ([]Migration, error)
+	Status(ctx context.Context) ([]MigrationStatus, error)
+}
+
+type migrations struct {
+	dal     Dal
+	dialect Dialect
+	dir     string
+}
+
+func NewMigrations(dal Dal, dir string) Migrations {
+	return &migrations{dal: dal, dialect: dialectOf(dal), dir: dir}
+}
+
+func (m *migrations) Up(ctx context.Context) ([]Migration, error) {
+	all, applied, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for _, migration := range all {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		mig := migration
+		ran := false
+		err := m.dal.Transactional(ctx, func(ctx context.Context) error {
+			if isApplied, err := m.lock(ctx, mig.Version); err != nil || isApplied {
+				return err
+			}
+			if _, err := m.dal.DoExec(ctx, mig.Up); err != nil {
+				return err
+			}
+			_, err := m.dal.DoExec(ctx, fmt.Sprintf("INSERT INTO %s (version) VALUES (%s)", MigrationsTable, m.dialect.Placeholder(1)), mig.Version)
+			ran = err == nil
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if ran {
+			done = append(done, mig)
+		}
+	}
+	return done, nil
+}
+
+func (m *migrations) Down(ctx context.Context, steps int) ([]Migration, error) {
+	all, applied, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var done []Migration
+	for i := len(all) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := all[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		ran := false
+		err := m.dal.Transactional(ctx, func(ctx context.Context) error {
+			if isApplied, err := m.lock(ctx, mig.Version); err != nil || !isApplied {
+				return err
+			}
+			// keeping the row of a migration that cannot be rolled back, up would apply it again otherwise
+			if mig.Down == "" {
+				return fmt.Errorf("migration %d has no down script", mig.Version)
+			}
+			if _, err := m.dal.DoExec(ctx, mig.Down); err != nil {
+				return err
+			}
+			_, err := m.dal.DoExec(ctx, fmt.Sprintf("DELETE FROM %s WHERE version = %s", MigrationsTable, m.dialect.Placeholder(1)), mig.Version)
+			ran = err == nil
+			return err
+		})
+		if err != nil {
+			return done, fmt.Errorf("migration %d_%s: %w", mig.Version, mig.Name, err)
+		}
+		if ran {
+			done = append(done, mig)
+		}
+	}
+	return done, nil
+}
+
+func (m *migrations) Status(ctx context.Context) ([]MigrationStatus, error) {
+	all, applied, err := m.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(all))
+	for i, mig := range all {
+		statuses[i] = MigrationStatus{Version: mig.Version, Name: mig.Name}
+		if s, ok := applied[mig.Version]; ok {
+			statuses[i].AppliedAt = s.AppliedAt
+		}
+	}
+	return statuses, nil
+}
+
+// lock serializes concurrent runs with a transaction scoped advisory lock on postgres
+// and reports whether the version is applied, as another run may have migrated it meanwhile
+func (m *migrations) lock(ctx context.Context, version uint64) (bool, error) {
+	if m.dialect == DialectPostgres {
+		if _, err := m.dal.DoExec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", MigrationsTable); err != nil {
+			return false, err
+		}
+	}
+	var count int
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE version = %s", MigrationsTable, m.dialect.Placeholder(1))
+	if err := m.dal.DoSelectScalar(ctx, &count, query, version); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (m *migrations) load(ctx context.Context) ([]Migration, map[uint64]MigrationStatus, error) {
+	all, err := m.readDir()
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := m.dal.DoExec(ctx, fmt.Sprintf(
+		"CREATE TABLE IF NOT EXISTS %s (version BIGINT PRIMARY KEY, applied_at TIMESTAMP NOT NULL DEFAULT now())",
+		MigrationsTable,
+	)); err != nil {
+		return nil, nil, err
+	}
+	var rows []MigrationStatus
+	if err := m.dal.DoSelect(ctx, &rows, fmt.Sprintf("SELECT version, applied_at FROM %s", MigrationsTable)); err != nil {
+		return nil, nil, err
+	}
+	applied := make(map[uint64]MigrationStatus, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return all, applied, nil
+}
+
+func (m *migrations) readDir() ([]Migration, error) {
+	entries, err := os.ReadDir(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[uint64]*Migration)
+	for _, entry := range entries {
+		matches := migrationFileRe.FindStringSubmatch(entry.Name())
+		if entry.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		content, err := os.ReadFile(filepath.Join(m.dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = mig
+		}
+		if matches[3] == "up" {
+			mig.Up = string(content)
+		} else {
+			mig.Down = string(content)
+		}
+	}
+	all := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", mig.Version, mig.Name)
+		}
+		all = append(all, *mig)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].Version < all[j].Version
+	})
+	return all, nil
+}
+
+// MigrationCommands returns `migrate up`, `migrate down [steps]` and `migrate status` commands
+func MigrationCommands(m Migrations) Commands {
+	return Commands{
+		{
+			Use:   "migrate",
+			Short: "Database schema migrations",
+			Children: Commands{
+				{
+					Use:   "up",
+					Short: "Apply pending migrations",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						done, err := m.Up(CommandContext(cmd))
+						for _, mig := range done {
+							cmd.Printf("applied %d_%s\n", mig.Version, mig.Name)
+						}
+						return err
+					},
+				},
+				{
+					Use:   "down [steps]",
+					Short: "Roll back applied migrations, one by default",
+					Args:  cobra.MaximumNArgs(1),
+					RunE: func(cmd *cobra.Command, args []string) error {
+						steps := 1
+						if len(args) > 0 {
+							n, err := strconv.Atoi(args[0])
+							if err != nil || n < 1 {
+								return fmt.Errorf("invalid steps %q", args[0])
+							}
+							steps = n
+						}
+						done, err := m.Down(CommandContext(cmd), steps)
+						for _, mig := range done {
+							cmd.Printf("rolled back %d_%s\n", mig.Version, mig.Name)
+						}
+						return err
+					},
+				},
+				{
+					Use:   "status",
+					Short: "Show migrations status",
+					Args:  cobra.NoArgs,
+					RunE: func(cmd *cobra.Command, args []string) error {
+						statuses, err := m.Status(CommandContext(cmd))
+						if err != nil {
+							return err
+						}
+						for _, s := range statuses {
+							state := "pending"
+							if s.Applied() {
+								state = s.AppliedAt.Format(time.RFC3339)
+							}
+							cmd.Printf("%d_%s\t%s\n", s.Version, s.Name, state)
+						}
+						return nil
+					},
+				},
+			},
+		},
+	}
+}
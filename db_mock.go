@@ -0,0 +1,437 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/slmder/qbuilder"
+)
+
+// MockCall a call recorded by MockDal, Query is the sql or the table name of the Find*/Delete methods.
+// Args end with the variadic allowed/opts/guard slice of the methods taking one.
+type MockCall struct {
+	Method string
+	Query  string
+	Args   []interface{}
+}
+
+// MockDal Dal for repository unit tests, calls are recorded and answered by the *Func fields.
+// Without a func the write methods succeed with MockDal.Result (one affected row by default),
+// selects leave dest untouched, Transactional runs the callback with ctx and builders are the qbuilder ones.
+// Variants share a func: DoInsertArgs, DoUpdateArgs and Execute use DoExecFunc, DoSelectCached uses DoSelectFunc,
+// InsertE/UpdateE/DeleteE use DoInsertFunc/DoUpdateFunc. Use MockFill to set dest from a func.
+type MockDal struct {
+	// Result of the write methods without a func
+	Result sql.Result
+	// Dialect of ToArgsAndExpressions, DialectPostgres by default
+	Dialect Dialect
+
+	PingFunc              func(ctx context.Context) error
+	DoInsertFunc          func(ctx context.Context, query string, entity interface{}) (sql.Result, error)
+	DoInsertReturningFunc func(ctx context.Context, query string, entity interface{}, dest interface{}) error
+	DoUpdateFunc          func(ctx context.Context, query string, entity interface{}) (sql.Result, error)
+	DoUpdateVersionedFunc func(ctx context.Context, query string, entity interface{}) (sql.Result, error)
+	DoUpdateCheckedFunc   func(ctx context.Context, query string, entity interface{}) error
+	DoPatchFunc           func(ctx context.Context, tableName string, id interface{}, changes map[string]interface{}, allowed []string) error
+	DoExecFunc            func(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	DoExecNamedFunc       func(ctx context.Context, query string, arg interface{}) (sql.Result, error)
+	DoSelectFunc          func(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	DoSelectOneFunc       func(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	DoSelectScalarFunc    func(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	DoSelectEachFunc      func(ctx context.Context, fn func(scan RowScanner) error, query string, args ...interface{}) error
+	TransactionalFunc     func(ctx context.Context, cb func(ctx context.Context) error) error
+	FindByFunc            func(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination, opts ...FindOptions) error
+	// FindByPagedFunc returns the total, without it FindByPaged counts the rows set by FindByFunc
+	FindByPagedFunc     func(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination, opts ...FindOptions) (uint64, error)
+	FindOneByFunc       func(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, opts ...FindOptions) error
+	FindByCursorFunc    func(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, cursorCol string, after interface{}, limit uint32, opts ...FindOptions) (interface{}, error)
+	SoftDeleteByKeyFunc func(ctx context.Context, tableName string, key qbuilder.Conditions) error
+	SoftDeleteWhereFunc func(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error)
+	DeleteFunc          func(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error)
+
+	mu    sync.Mutex
+	calls []MockCall
+}
+
+var _ Dal = (*MockDal)(nil)
+
+// MockFill assigns value to the pointer dest, e.g. the rows a DoSelectFunc returns
+func MockFill(dest interface{}, value interface{}) error {
+	target := reflect.ValueOf(dest)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("mock destination must be a non nil pointer, not %T", dest)
+	}
+	v := reflect.Indirect(reflect.ValueOf(value))
+	if !v.Type().AssignableTo(target.Elem().Type()) {
+		return fmt.Errorf("cannot assign %s to mock destination %T", v.Type(), dest)
+	}
+	target.Elem().Set(v)
+	return nil
+}
+
+// Calls recorded so far, in call order
+func (m *MockDal) Calls() []MockCall {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]MockCall(nil), m.calls...)
+}
+
+// CallsTo the recorded calls of one method, e.g. CallsTo("DoInsert")
+func (m *MockDal) CallsTo(method string) []MockCall {
+	var calls []MockCall
+	for _, call := range m.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (m *MockDal) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = nil
+}
+
+func (m *MockDal) record(method string, query string, args ...interface{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, MockCall{Method: method, Query: query, Args: args})
+}
+
+func (m *MockDal) result() sql.Result {
+	if m.Result != nil {
+		return m.Result
+	}
+	return driver.RowsAffected(1)
+}
+
+func (m *MockDal) Connection() *sqlx.DB {
+	return nil
+}
+
+func (m *MockDal) Ping(ctx context.Context) error {
+	m.record("Ping", "")
+	if m.PingFunc != nil {
+		return m.PingFunc(ctx)
+	}
+	return nil
+}
+
+func (m *MockDal) Transaction(ctx context.Context) *sqlx.Tx {
+	return nil
+}
+
+func (m *MockDal) DoInsert(ctx context.Context, query string, entity interface{}) (sql.Result, error) {
+	m.record("DoInsert", query, entity)
+	if m.DoInsertFunc != nil {
+		return m.DoInsertFunc(ctx, query, entity)
+	}
+	return m.result(), nil
+}
+
+func (m *MockDal) DoInsertReturning(ctx context.Context, query string, entity interface{}, dest interface{}) error {
+	m.record("DoInsertReturning", query, entity)
+	if m.DoInsertReturningFunc != nil {
+		return m.DoInsertReturningFunc(ctx, query, entity, dest)
+	}
+	return nil
+}
+
+func (m *MockDal) DoUpdate(ctx context.Context, query string, entity interface{}) (sql.Result, error) {
+	m.record("DoUpdate", query, entity)
+	if m.DoUpdateFunc != nil {
+		return m.DoUpdateFunc(ctx, query, entity)
+	}
+	return m.result(), nil
+}
+
+func (m *MockDal) DoUpdateVersioned(ctx context.Context, query string, entity interface{}) (sql.Result, error) {
+	m.record("DoUpdateVersioned", query, entity)
+	if m.DoUpdateVersionedFunc != nil {
+		return m.DoUpdateVersionedFunc(ctx, query, entity)
+	}
+	return m.result(), nil
+}
+
+func (m *MockDal) DoUpdateChecked(ctx context.Context, query string, entity interface{}) error {
+	m.record("DoUpdateChecked", query, entity)
+	if m.DoUpdateCheckedFunc != nil {
+		return m.DoUpdateCheckedFunc(ctx, query, entity)
+	}
+	return nil
+}
+
+func (m *MockDal) DoPatch(ctx context.Context, tableName string, id interface{}, changes map[string]interface{}, allowed []string) error {
+	m.record("DoPatch", tableName, id, changes, allowed)
+	if m.DoPatchFunc != nil {
+		return m.DoPatchFunc(ctx, tableName, id, changes, allowed)
+	}
+	return nil
+}
+
+func (m *MockDal) DoInsertArgs(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.exec(ctx, "DoInsertArgs", query, args)
+}
+
+func (m *MockDal) DoUpdateArgs(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.exec(ctx, "DoUpdateArgs", query, args)
+}
+
+func (m *MockDal) DoExec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.exec(ctx, "DoExec", query, args)
+}
+
+func (m *MockDal) Execute(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return m.exec(ctx, "Execute", query, args)
+}
+
+func (m *MockDal) exec(ctx context.Context, method string, query string, args []interface{}) (sql.Result, error) {
+	m.record(method, query, args...)
+	if m.DoExecFunc != nil {
+		return m.DoExecFunc(ctx, query, args...)
+	}
+	return m.result(), nil
+}
+
+func (m *MockDal) DoExecNamed(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	m.record("DoExecNamed", query, arg)
+	if m.DoExecNamedFunc != nil {
+		return m.DoExecNamedFunc(ctx, query, arg)
+	}
+	return m.result(), nil
+}
+
+func (m *MockDal) DoSelect(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return m.selectRows(ctx, "DoSelect", dest, query, args)
+}
+
+func (m *MockDal) DoSelectCached(ctx context.Context, ttl time.Duration, dest interface{}, query string, args ...interface{}) error {
+	return m.selectRows(ctx, "DoSelectCached", dest, query, args)
+}
+
+func (m *MockDal) selectRows(ctx context.Context, method string, dest interface{}, query string, args []interface{}) error {
+	m.record(method, query, args...)
+	if m.DoSelectFunc != nil {
+		return m.DoSelectFunc(ctx, dest, query, args...)
+	}
+	return nil
+}
+
+func (m *MockDal) DoSelectOne(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	m.record("DoSelectOne", query, args...)
+	if m.DoSelectOneFunc != nil {
+		return m.DoSelectOneFunc(ctx, dest, query, args...)
+	}
+	return nil
+}
+
+func (m *MockDal) DoSelectScalar(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	m.record("DoSelectScalar", query, args...)
+	if m.DoSelectScalarFunc != nil {
+		return m.DoSelectScalarFunc(ctx, dest, query, args...)
+	}
+	return nil
+}
+
+func (m *MockDal) DoSelectEach(ctx context.Context, fn func(scan RowScanner) error, query string, args ...interface{}) error {
+	m.record("DoSelectEach", query, args...)
+	if m.DoSelectEachFunc != nil {
+		return m.DoSelectEachFunc(ctx, fn, query, args...)
+	}
+	return nil
+}
+
+func (m *MockDal) InvalidateQueryCache(prefix string) {
+	m.record("InvalidateQueryCache", prefix)
+}
+
+func (m *MockDal) Transactional(ctx context.Context, cb func(ctx context.Context) error) error {
+	m.record("Transactional", "")
+	if m.TransactionalFunc != nil {
+		return m.TransactionalFunc(ctx, cb)
+	}
+	return cb(ctx)
+}
+
+// Batch queued statements are passed to DoExec on Flush
+func (m *MockDal) Batch(ctx context.Context) Batch {
+	return &mockBatch{dal: m}
+}
+
+func (m *MockDal) SubSelect(sel string) *qbuilder.SelectBuilder {
+	return qbuilder.SubSelect(sel)
+}
+
+func (m *MockDal) BuildSelect(sel ...string) *qbuilder.SelectBuilder {
+	return qbuilder.Select(sel...)
+}
+
+func (m *MockDal) SelectE(obj interface{}, alias ...string) *qbuilder.SelectBuilder {
+	return qbuilder.SelectE(obj, alias...)
+}
+
+func (m *MockDal) BuildInsert(into string) *qbuilder.InsertBuilder {
+	return qbuilder.Insert(into)
+}
+
+func (m *MockDal) InsertE(ctx context.Context, table string, obj interface{}) (sql.Result, error) {
+	return m.DoInsert(ctx, qbuilder.Insert(table).RowE(obj).ToSQL(), obj)
+}
+
+func (m *MockDal) BuildUpdate(rel string) *qbuilder.UpdateBuilder {
+	return qbuilder.Update(rel)
+}
+
+func (m *MockDal) UpdateE(ctx context.Context, table string, obj interface{}, where ...string) (sql.Result, error) {
+	expr := "id = :id"
+	if len(where) > 0 {
+		expr = where[0]
+	}
+	return m.DoUpdate(ctx, qbuilder.Update(table).SetMapE(obj).Where(expr).ToSQL(), obj)
+}
+
+func (m *MockDal) BuildDelete(rel string) *qbuilder.DeleteBuilder {
+	return qbuilder.Delete(rel)
+}
+
+func (m *MockDal) DeleteE(ctx context.Context, table string, obj interface{}, where ...string) (sql.Result, error) {
+	expr := "id = :id"
+	if len(where) > 0 {
+		expr = where[0]
+	}
+	return m.DoUpdate(ctx, qbuilder.Delete(table).Where(expr).ToSQL(), obj)
+}
+
+func (m *MockDal) ToArgsAndExpressions(conditions map[string]interface{}) ([]interface{}, []string) {
+	dialect := m.Dialect
+	if dialect == "" {
+		dialect = DialectPostgres
+	}
+	return (&dal{dialect: dialect}).ToArgsAndExpressions(conditions)
+}
+
+func (m *MockDal) PipeErr(err error) error {
+	return HandleError(err)
+}
+
+func (m *MockDal) FindBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination, opts ...FindOptions) error {
+	m.record("FindBy", tableName, cond, pag, opts)
+	if m.FindByFunc != nil {
+		return m.FindByFunc(ctx, tableName, dest, cond, pag, opts...)
+	}
+	return nil
+}
+
+func (m *MockDal) FindByPaged(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, pag Pagination, opts ...FindOptions) (uint64, error) {
+	m.record("FindByPaged", tableName, cond, pag, opts)
+	if m.FindByPagedFunc != nil {
+		return m.FindByPagedFunc(ctx, tableName, dest, cond, pag, opts...)
+	}
+	if m.FindByFunc != nil {
+		if err := m.FindByFunc(ctx, tableName, dest, cond, pag, opts...); err != nil {
+			return 0, err
+		}
+	}
+	if rows := reflect.Indirect(reflect.ValueOf(dest)); rows.Kind() == reflect.Slice {
+		return uint64(rows.Len()), nil
+	}
+	return 0, nil
+}
+
+func (m *MockDal) FindOneBy(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, opts ...FindOptions) error {
+	m.record("FindOneBy", tableName, cond, opts)
+	if m.FindOneByFunc != nil {
+		return m.FindOneByFunc(ctx, tableName, dest, cond, opts...)
+	}
+	return nil
+}
+
+func (m *MockDal) FindByCursor(ctx context.Context, tableName string, dest interface{}, cond qbuilder.Conditions, cursorCol string, after interface{}, limit uint32, opts ...FindOptions) (interface{}, error) {
+	m.record("FindByCursor", tableName, cond, cursorCol, after, limit, opts)
+	if m.FindByCursorFunc != nil {
+		return m.FindByCursorFunc(ctx, tableName, dest, cond, cursorCol, after, limit, opts...)
+	}
+	return nil, nil
+}
+
+func (m *MockDal) SoftDelete(ctx context.Context, tableName string, id uuid.UUID) error {
+	return m.SoftDeleteByKey(ctx, tableName, qbuilder.Conditions{"id": id})
+}
+
+func (m *MockDal) SoftDeleteByKey(ctx context.Context, tableName string, key qbuilder.Conditions) error {
+	m.record("SoftDeleteByKey", tableName, key)
+	if m.SoftDeleteByKeyFunc != nil {
+		return m.SoftDeleteByKeyFunc(ctx, tableName, key)
+	}
+	return nil
+}
+
+func (m *MockDal) SoftDeleteWhere(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error) {
+	m.record("SoftDeleteWhere", tableName, cond, guard)
+	if len(cond) == 0 && !allowAllRows(guard) {
+		return 0, Wrap(ErrEmptyConditions)
+	}
+	if m.SoftDeleteWhereFunc != nil {
+		return m.SoftDeleteWhereFunc(ctx, tableName, cond, guard...)
+	}
+	return AffectedRows(m.result(), nil)
+}
+
+func (m *MockDal) Delete(ctx context.Context, tableName string, cond qbuilder.Conditions, guard ...BulkGuard) (int64, error) {
+	m.record("Delete", tableName, cond, guard)
+	if len(cond) == 0 && !allowAllRows(guard) {
+		return 0, Wrap(ErrEmptyConditions)
+	}
+	if m.DeleteFunc != nil {
+		return m.DeleteFunc(ctx, tableName, cond, guard...)
+	}
+	return AffectedRows(m.result(), nil)
+}
+
+type mockBatch struct {
+	dal        *MockDal
+	mu         sync.Mutex
+	statements []queuedStatement
+}
+
+func (b *mockBatch) Queue(query string, args ...interface{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.statements = append(b.statements, queuedStatement{query: query, args: args})
+}
+
+func (b *mockBatch) QueueNamed(query string, arg interface{}) error {
+	b.Queue(query, arg)
+	return nil
+}
+
+func (b *mockBatch) QueueInsert(query string, entity interface{}) error {
+	return b.QueueNamed(query, entity)
+}
+
+func (b *mockBatch) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.statements)
+}
+
+func (b *mockBatch) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	statements := b.statements
+	b.statements = nil
+	b.mu.Unlock()
+	for _, s := range statements {
+		if _, err := b.dal.DoExec(ctx, s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,17 +1,25 @@
 package core
 
-import "github.com/jmoiron/sqlx"
+import (
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/multierr"
+)
 
 type ModuleStorage interface {
 	Transactions() Transactions
 	DbConnection() *sqlx.DB
+	ReplicaConnection() *sqlx.DB
 	Dal() Dal
+	// Health monitor of the connections, not running until Run is called
+	Health() HealthMonitor
 }
 
 type moduleStorage struct {
 	transactions Transactions
 	dBConnection *sqlx.DB
+	replica      *sqlx.DB
 	dbal         Dal
+	health       HealthMonitor
 }
 
 func (m *moduleStorage) Transactions() Transactions {
@@ -22,15 +30,48 @@ func (m *moduleStorage) DbConnection() *sqlx.DB {
 	return m.dBConnection
 }
 
+func (m *moduleStorage) ReplicaConnection() *sqlx.DB {
+	return m.replica
+}
+
 func (m *moduleStorage) Dal() Dal {
 	return m.dbal
 }
 
-func NewModule(driverName, databaseDsn string) ModuleStorage {
+func (m *moduleStorage) Health() HealthMonitor {
+	return m.health
+}
+
+func NewModule(driverName, databaseDsn string, config ...DatabaseConfig) ModuleStorage {
+	m, err := NewModuleE(driverName, databaseDsn, config...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func NewModuleE(driverName, databaseDsn string, config ...DatabaseConfig) (ModuleStorage, error) {
 	var m moduleStorage
-	m.dBConnection = NewConnection(driverName, databaseDsn)
+	var cfg DatabaseConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	conn, err := connectWithRetry(driverName, databaseDsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.dBConnection = conn
+	if cfg.ReplicaDsn != "" {
+		replica, err := connectWithRetry(driverName, cfg.ReplicaDsn, cfg)
+		if err != nil {
+			return nil, multierr.Combine(err, conn.Close())
+		}
+		m.replica = replica
+		cfg.Dal.Replica = m.replica
+	}
 	m.transactions = NewTransactionManager(m.dBConnection, NewDefaultTransactionManagerConfig())
-	m.dbal = NewDAL(m.dBConnection, m.transactions)
+	m.dbal = NewDAL(m.dBConnection, m.transactions, cfg.Dal)
+	m.health = NewHealthMonitor(m.dbal, cfg.Health)
 
-	return &m
+	return &m, nil
 }
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const NotificationEventName = "core.db.notification"
+
+// NotificationEventNameFor event name dispatched for notifications on the given channel
+func NotificationEventNameFor(channel string) string {
+	return fmt.Sprintf("%s.%s", NotificationEventName, channel)
+}
+
+type NotificationEvent struct {
+	Channel string
+	Payload string
+	PID     int
+}
+
+func (e NotificationEvent) GetName() string {
+	return NotificationEventNameFor(e.Channel)
+}
+
+type NotificationListenerConfig struct {
+	MinReconnectInterval time.Duration
+	MaxReconnectInterval time.Duration
+	PingInterval         time.Duration
+}
+
+type NotificationListener interface {
+	// Listen blocks dispatching notifications until ctx is done or the listener is closed
+	Listen(ctx context.Context) error
+	Close() error
+}
+
+type notificationListener struct {
+	listener   *pq.Listener
+	channels   []string
+	dispatcher EventDispatcher
+	config     NotificationListenerConfig
+}
+
+func NewNotificationListener(dsn string, dispatcher EventDispatcher, channels ...string) NotificationListener {
+	return NewNotificationListenerWithConfig(dsn, dispatcher, NotificationListenerConfig{}, channels...)
+}
+
+func NewNotificationListenerWithConfig(dsn string, dispatcher EventDispatcher, config NotificationListenerConfig, channels ...string) NotificationListener {
+	cfg := NotificationListenerConfig{
+		MinReconnectInterval: 10 * time.Second,
+		MaxReconnectInterval: time.Minute,
+		PingInterval:         90 * time.Second,
+	}
+	if config.MinReconnectInterval > 0 {
+		cfg.MinReconnectInterval = config.MinReconnectInterval
+	}
+	if config.MaxReconnectInterval > 0 {
+		cfg.MaxReconnectInterval = config.MaxReconnectInterval
+	}
+	if config.PingInterval > 0 {
+		cfg.PingInterval = config.PingInterval
+	}
+	listener := pq.NewListener(dsn, cfg.MinReconnectInterval, cfg.MaxReconnectInterval, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			GetLogger().Warn("notification listener event", Fields{"event": int(event), "error": err.Error()})
+		}
+	})
+	return &notificationListener{
+		listener:   listener,
+		channels:   channels,
+		dispatcher: dispatcher,
+		config:     cfg,
+	}
+}
+
+func (l *notificationListener) Listen(ctx context.Context) error {
+	for _, channel := range l.channels {
+		if err := l.listener.Listen(channel); err != nil {
+			return err
+		}
+	}
+	ping := time.NewTicker(l.config.PingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n, ok := <-l.listener.Notify:
+			// the channel is closed by Close
+			if !ok {
+				return nil
+			}
+			// nil is sent after reconnect, notifications in between are lost
+			if n == nil {
+				GetLogger().Warn("notification listener reconnected")
+				continue
+			}
+			event := NotificationEvent{Channel: n.Channel, Payload: n.Extra, PID: n.BePid}
+			if err := l.dispatcher.Dispatch(ctx, event); err != nil {
+				GetLogger().Error("notification dispatch failed", Fields{"channel": n.Channel, "error": err.Error()})
+			}
+		case <-ping.C:
+			go func() {
+				if err := l.listener.Ping(); err != nil {
+					GetLogger().Warn("notification listener ping failed", Fields{"error": err.Error()})
+				}
+			}()
+		}
+	}
+}
+
+func (l *notificationListener) Close() error {
+	return l.listener.Close()
+}
@@ -0,0 +1,232 @@
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	OutboxTable = "outbox"
+
+	DefaultOutboxMaxAttempts     = 10
+	DefaultOutboxRetryBackoff    = 5 * time.Second
+	DefaultOutboxMaxRetryBackoff = time.Hour
+)
+
+// OutboxEvent is what the relay publishes, subscribers decode Payload into the event they enqueued
+type OutboxEvent struct {
+	ID        uuid.UUID       `db:"id"`
+	Name      string          `db:"event_name"`
+	Payload   json.RawMessage `db:"payload"`
+	Attempts  int             `db:"attempts"`
+	CreatedAt time.Time       `db:"created_at"`
+}
+
+func (e OutboxEvent) GetName() string {
+	return e.Name
+}
+
+// OutboxPublisher delivers a relayed event, e.g. to a message broker
+type OutboxPublisher func(ctx context.Context, event OutboxEvent) error
+
+type OutboxConfig struct {
+	Table string
+	// Publisher defaults to dispatching through the EventDispatcher
+	Publisher    OutboxPublisher
+	PollInterval time.Duration
+	BatchSize    int
+	// MaxAttempts after which a failing event is dead-lettered (failed_at set) and no longer relayed
+	MaxAttempts int
+	// RetryBackoff delay before the first retry of a failed event, doubled on every further failure up to MaxRetryBackoff
+	RetryBackoff    time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+type Outbox interface {
+	// Enqueue writes the event to the outbox in the transaction of ctx (a new one when there is none),
+	// it is relayed once the transaction commits.
+	Enqueue(ctx context.Context, event Event) error
+	// Relay publishes up to BatchSize pending events, returns the number of published ones
+	Relay(ctx context.Context) (int, error)
+	// Run polls the outbox as a relay fallback until ctx is done
+	Run(ctx context.Context) error
+	// CreateTable creates the outbox table if it does not exist
+	CreateTable(ctx context.Context) error
+}
+
+type outbox struct {
+	dal     Dal
+	dialect Dialect
+	config  OutboxConfig
+}
+
+func NewOutbox(dal Dal, dispatcher EventDispatcher, config ...OutboxConfig) Outbox {
+	cfg := OutboxConfig{
+		Table:           OutboxTable,
+		PollInterval:    5 * time.Second,
+		BatchSize:       100,
+		MaxAttempts:     DefaultOutboxMaxAttempts,
+		RetryBackoff:    DefaultOutboxRetryBackoff,
+		MaxRetryBackoff: DefaultOutboxMaxRetryBackoff,
+	}
+	if len(config) > 0 {
+		if config[0].Table != "" {
+			cfg.Table = config[0].Table
+		}
+		if config[0].PollInterval > 0 {
+			cfg.PollInterval = config[0].PollInterval
+		}
+		if config[0].BatchSize > 0 {
+			cfg.BatchSize = config[0].BatchSize
+		}
+		if config[0].MaxAttempts > 0 {
+			cfg.MaxAttempts = config[0].MaxAttempts
+		}
+		if config[0].RetryBackoff > 0 {
+			cfg.RetryBackoff = config[0].RetryBackoff
+		}
+		if config[0].MaxRetryBackoff > 0 {
+			cfg.MaxRetryBackoff = config[0].MaxRetryBackoff
+		}
+		cfg.Publisher = config[0].Publisher
+	}
+	if cfg.Publisher == nil {
+		cfg.Publisher = func(ctx context.Context, event OutboxEvent) error {
+			return dispatchEventSilent(ctx, dispatcher, event)
+		}
+	}
+	return &outbox{dal: dal, dialect: dialectOf(dal), config: cfg}
+}
+
+func (o *outbox) CreateTable(ctx context.Context) error {
+	_, err := o.dal.DoExec(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id UUID PRIMARY KEY,
+		event_name TEXT NOT NULL,
+		payload JSONB NOT NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMP NULL,
+		created_at TIMESTAMP NOT NULL DEFAULT now(),
+		dispatched_at TIMESTAMP NULL,
+		failed_at TIMESTAMP NULL
+	)`, o.config.Table))
+	return err
+}
+
+func (o *outbox) Enqueue(ctx context.Context, event Event) error {
+	payload, err := marshalJSON(event)
+	if err != nil {
+		return Wrap(err)
+	}
+	id := uuid.New()
+	return o.dal.Transactional(ctx, func(ctx context.Context) error {
+		query := fmt.Sprintf("INSERT INTO %s (id, event_name, payload) VALUES (%s, %s, %s)",
+			o.config.Table, o.dialect.Placeholder(1), o.dialect.Placeholder(2), o.dialect.Placeholder(3))
+		if _, err := o.dal.DoExec(ctx, query, id, event.GetName(), string(payload)); err != nil {
+			return err
+		}
+		RegisterAfterCommit(ctx, func() {
+			// the transaction is gone, the relay runs in its own one
+			relayCtx := withoutTransaction(ctx)
+			if _, err := o.relay(relayCtx, fmt.Sprintf("id = %s", o.dialect.Placeholder(1)), id); err != nil {
+				LoggerFromContext(relayCtx).Warn(fmt.Sprintf("outbox relay of %s: %s, left to the poller", id, err))
+			}
+		})
+		return nil
+	})
+}
+
+func (o *outbox) Relay(ctx context.Context) (int, error) {
+	return o.relay(ctx, "TRUE")
+}
+
+func (o *outbox) Run(ctx context.Context) error {
+	ticker := time.NewTicker(o.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := o.Relay(ctx)
+			if err != nil {
+				LoggerFromContext(ctx).Warn(fmt.Sprintf("outbox relay: %s", err))
+			}
+			// drain the backlog before waiting for the next tick
+			if err != nil || n < o.config.BatchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay locks pending events with SKIP LOCKED so the after commit relay and pollers never publish concurrently.
+// Failed ones are retried with backoff once next_attempt_at is due (at-least-once delivery), so they do not hold
+// back newer events, and are dead-lettered after MaxAttempts.
+func (o *outbox) relay(ctx context.Context, where string, args ...interface{}) (int, error) {
+	published := 0
+	// where comes first in the statement so positional placeholders bind in order
+	args = append(args, time.Now())
+	err := o.dal.Transactional(ctx, func(ctx context.Context) error {
+		var events []OutboxEvent
+		query := fmt.Sprintf(
+			"SELECT id, event_name, payload, attempts, created_at FROM %s WHERE dispatched_at IS NULL AND failed_at IS NULL AND %s AND (next_attempt_at IS NULL OR next_attempt_at <= %s) ORDER BY created_at LIMIT %d FOR UPDATE SKIP LOCKED",
+			o.config.Table, where, o.dialect.Placeholder(len(args)), o.config.BatchSize,
+		)
+		if err := o.dal.DoSelect(ctx, &events, query, args...); err != nil {
+			return err
+		}
+		for _, event := range events {
+			if err := o.config.Publisher(ctx, event); err != nil {
+				if err := o.fail(ctx, event, err); err != nil {
+					return err
+				}
+				continue
+			}
+			if _, err := o.dal.DoExec(ctx, fmt.Sprintf("UPDATE %s SET dispatched_at = now() WHERE id = %s", o.config.Table, o.dialect.Placeholder(1)), event.ID); err != nil {
+				return err
+			}
+			published++
+		}
+		return nil
+	})
+	return published, err
+}
+
+// fail records the failed attempt, schedules the retry or dead-letters the event after MaxAttempts
+func (o *outbox) fail(ctx context.Context, event OutboxEvent, cause error) error {
+	attempts := event.Attempts + 1
+	if attempts >= o.config.MaxAttempts {
+		LoggerFromContext(ctx).Error(fmt.Sprintf("outbox publish %s %s: %s, dead-lettered after %d attempts", event.Name, event.ID, cause, attempts))
+		query := fmt.Sprintf("UPDATE %s SET attempts = %s, failed_at = %s WHERE id = %s",
+			o.config.Table, o.dialect.Placeholder(1), o.dialect.Placeholder(2), o.dialect.Placeholder(3))
+		_, err := o.dal.DoExec(ctx, query, attempts, time.Now(), event.ID)
+		return err
+	}
+	next := time.Now().Add(o.retryBackoff(attempts))
+	LoggerFromContext(ctx).Warn(fmt.Sprintf("outbox publish %s %s: %s, retry at %s", event.Name, event.ID, cause, next.Format(time.RFC3339)))
+	query := fmt.Sprintf("UPDATE %s SET attempts = %s, next_attempt_at = %s WHERE id = %s",
+		o.config.Table, o.dialect.Placeholder(1), o.dialect.Placeholder(2), o.dialect.Placeholder(3))
+	_, err := o.dal.DoExec(ctx, query, attempts, next, event.ID)
+	return err
+}
+
+// retryBackoff RetryBackoff doubled per failed attempt, capped at MaxRetryBackoff
+func (o *outbox) retryBackoff(attempts int) time.Duration {
+	backoff := float64(o.config.RetryBackoff) * math.Pow(2, float64(attempts-1))
+	if backoff > float64(o.config.MaxRetryBackoff) {
+		return o.config.MaxRetryBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// withoutTransaction detaches ctx from its (resolved) transaction
+func withoutTransaction(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txKey, (*transaction)(nil))
+}
@@ -0,0 +1,54 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// ColumnID primary key column the row of DoPatch is matched by
+const ColumnID = "id"
+
+var columnNameRe = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// DoPatch updates only the given columns of the row identified by id, e.g. from a PATCH payload.
+// The patchable columns must be listed in allowed, other keys and the id column are skipped.
+// Empty changes are a no-op, ObjectNotFoundErr is returned when the row does not exist.
+func (d *dal) DoPatch(ctx context.Context, tableName string, id interface{}, changes map[string]interface{}, allowed []string) error {
+	if len(changes) == 0 {
+		return nil
+	}
+	if len(allowed) == 0 {
+		return Wrap(fmt.Errorf("patch %s: no allowed columns", tableName))
+	}
+	columns := make([]string, 0, len(changes))
+	for column := range changes {
+		if column == ColumnID || !columnNameRe.MatchString(column) || !StringsContains(allowed, column) {
+			LoggerFromContext(ctx).Debug(fmt.Sprintf("patch %s: column %q skipped", tableName, column))
+			continue
+		}
+		columns = append(columns, column)
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+	// sorted for stable statements, set values bind first since mysql placeholders are positional
+	sort.Strings(columns)
+	builder := d.BuildUpdate(tableName)
+	args := make([]interface{}, 0, len(columns)+1)
+	for _, column := range columns {
+		args = append(args, changes[column])
+		builder.Set(column, d.dialect.Placeholder(len(args)))
+	}
+	args = append(args, id)
+	builder.Where(fmt.Sprintf("%s = %s", ColumnID, d.dialect.Placeholder(len(args))))
+	affected, err := AffectedRows(d.DoExec(ctx, builder.ToSQL(), args...))
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ObjectNotFoundErr()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package core
+
+import (
+	"context"
+	"database/sql/driver"
+	"sync"
+)
+
+type queryRecorderKeyType string
+
+const queryRecorderKey = queryRecorderKeyType("db.query_recorder")
+
+type CapturedQuery struct {
+	Query string
+	Args  []interface{}
+}
+
+// QueryRecorder captures the statements the DAL runs with a context returned by WithQueryRecorder.
+// In dry run mode statements are not executed: selects leave dest untouched, execs report one affected row
+// (see SetRowsAffected) so affected rows checks pass, and Transactional runs the callback without a transaction.
+type QueryRecorder struct {
+	mu           sync.Mutex
+	dryRun       bool
+	rowsAffected int64
+	queries      []CapturedQuery
+}
+
+func NewQueryRecorder(dryRun bool) *QueryRecorder {
+	return &QueryRecorder{dryRun: dryRun, rowsAffected: 1}
+}
+
+// SetRowsAffected reported by the statements skipped in dry run mode, e.g. 0 to exercise not found paths
+func (r *QueryRecorder) SetRowsAffected(n int64) {
+	r.mu.Lock()
+	r.rowsAffected = n
+	r.mu.Unlock()
+}
+
+func (r *QueryRecorder) result() driver.Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return driver.RowsAffected(r.rowsAffected)
+}
+
+// Queries captured statements in execution order
+func (r *QueryRecorder) Queries() []CapturedQuery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	queries := make([]CapturedQuery, len(r.queries))
+	copy(queries, r.queries)
+	return queries
+}
+
+// Last the most recent captured statement, false when nothing was captured
+func (r *QueryRecorder) Last() (CapturedQuery, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queries) == 0 {
+		return CapturedQuery{}, false
+	}
+	return r.queries[len(r.queries)-1], true
+}
+
+func (r *QueryRecorder) Reset() {
+	r.mu.Lock()
+	r.queries = nil
+	r.mu.Unlock()
+}
+
+func (r *QueryRecorder) record(query string, args []interface{}) {
+	r.mu.Lock()
+	r.queries = append(r.queries, CapturedQuery{Query: query, Args: args})
+	r.mu.Unlock()
+}
+
+func WithQueryRecorder(ctx context.Context, recorder *QueryRecorder) context.Context {
+	return context.WithValue(ctx, queryRecorderKey, recorder)
+}
+
+func queryRecorderFromContext(ctx context.Context) *QueryRecorder {
+	recorder, _ := ctx.Value(queryRecorderKey).(*QueryRecorder)
+	return recorder
+}
+
+// isDryRun reports whether statements of ctx are only recorded
+func isDryRun(ctx context.Context) bool {
+	recorder := queryRecorderFromContext(ctx)
+	return recorder != nil && recorder.dryRun
+}
@@ -0,0 +1,57 @@
+package core
+
+import (
+	"reflect"
+	"time"
+)
+
+const (
+	ColumnCreatedAt = "created_at"
+	ColumnUpdatedAt = "updated_at"
+	ColumnDeletedAt = "deleted_at"
+
+	// dalTagAuto marks a timestamp field to be stamped by the DAL, e.g.
+	//	CreatedAt time.Time `db:"created_at" dal:"auto"`
+	// A separate tag is used since qbuilder takes the db tag verbatim as a column name.
+	dalTagName = "dal"
+	dalTagAuto = "auto"
+)
+
+// stampTimestamps sets auto tagged created_at/updated_at fields of the given struct pointer.
+// Values other than struct pointers are left untouched.
+func stampTimestamps(entity interface{}, columns ...string) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	stampStruct(v, time.Now().UTC(), columns)
+}
+
+func stampStruct(v reflect.Value, now time.Time, columns []string) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			stampStruct(fv, now, columns)
+			continue
+		}
+		if field.Tag.Get(dalTagName) != dalTagAuto || !fv.CanSet() {
+			continue
+		}
+		if !StringsContains(columns, field.Tag.Get("db")) {
+			continue
+		}
+		switch fv.Interface().(type) {
+		case time.Time:
+			fv.Set(reflect.ValueOf(now))
+		case *time.Time:
+			stamp := now
+			fv.Set(reflect.ValueOf(&stamp))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+type txHooks struct {
+	mu            sync.Mutex
+	beforeCommit  []func(ctx context.Context) error
+	afterCommit   []func()
+	afterRollback []func()
+}
+
+// RegisterBeforeCommit hook runs inside the outermost transaction right before the commit,
+// an error rolls the transaction back. Without a transaction in ctx the hook runs immediately.
+func RegisterBeforeCommit(ctx context.Context, hook func(ctx context.Context) error) error {
+	t := extractTransactionFromContext(ctx)
+	if t == nil {
+		return hook(ctx)
+	}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	t.hooks.beforeCommit = append(t.hooks.beforeCommit, hook)
+	return nil
+}
+
+// RegisterAfterCommit hook runs once the outermost transaction has been committed,
+// without a transaction in ctx it runs immediately.
+func RegisterAfterCommit(ctx context.Context, hook func()) {
+	t := extractTransactionFromContext(ctx)
+	if t == nil {
+		runTxHook(hook)
+		return
+	}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	t.hooks.afterCommit = append(t.hooks.afterCommit, hook)
+}
+
+// RegisterAfterRollback hook runs once the outermost transaction has been rolled back,
+// without a transaction in ctx it is discarded.
+func RegisterAfterRollback(ctx context.Context, hook func()) {
+	t := extractTransactionFromContext(ctx)
+	if t == nil {
+		return
+	}
+	t.hooks.mu.Lock()
+	defer t.hooks.mu.Unlock()
+	t.hooks.afterRollback = append(t.hooks.afterRollback, hook)
+}
+
+// runBeforeCommit hooks may register further hooks while running, hence the lock per iteration
+func (h *txHooks) runBeforeCommit(ctx context.Context) error {
+	for i := 0; ; i++ {
+		h.mu.Lock()
+		if i >= len(h.beforeCommit) {
+			h.mu.Unlock()
+			return nil
+		}
+		hook := h.beforeCommit[i]
+		h.mu.Unlock()
+		if err := hook(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+func (h *txHooks) runAfterCommit() {
+	h.mu.Lock()
+	hooks := h.afterCommit
+	h.afterCommit, h.afterRollback = nil, nil
+	h.mu.Unlock()
+	for _, hook := range hooks {
+		runTxHook(hook)
+	}
+}
+
+func (h *txHooks) runAfterRollback() {
+	h.mu.Lock()
+	hooks := h.afterRollback
+	h.afterCommit, h.afterRollback = nil, nil
+	h.mu.Unlock()
+	for _, hook := range hooks {
+		runTxHook(hook)
+	}
+}
+
+// runTxHook the transaction is already resolved, a panicking hook must not surface as a failed transaction
+func runTxHook(hook func()) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			GetLogger().Error("transaction hook recovered from panic", Fields{"panic": rec})
+		}
+	}()
+	hook()
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// JSONB maps a Go value to a json/jsonb column.
+// Nil maps, slices and pointers are stored as NULL, NULL is scanned as the zero value.
+type JSONB[T any] struct {
+	Data T
+}
+
+func NewJSONB[T any](data T) JSONB[T] {
+	return JSONB[T]{Data: data}
+}
+
+func (j JSONB[T]) Value() (driver.Value, error) {
+	if isNilValue(j.Data) {
+		return nil, nil
+	}
+	return json.Marshal(j.Data)
+}
+
+func (j *JSONB[T]) Scan(src interface{}) error {
+	var zero T
+	j.Data = zero
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, &j.Data)
+	case string:
+		return json.Unmarshal([]byte(v), &j.Data)
+	}
+	return fmt.Errorf("unsupported JSONB source type %T", src)
+}
+
+func (j JSONB[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Data)
+}
+
+func (j *JSONB[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &j.Data)
+}
+
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// Postgres array column types, use them for entity fields mapped to array columns
+type (
+	StringArray  = pq.StringArray
+	Int64Array   = pq.Int64Array
+	Float64Array = pq.Float64Array
+	BoolArray    = pq.BoolArray
+)
+
+// UUIDArray maps []uuid.UUID to a uuid[] column
+type UUIDArray []uuid.UUID
+
+func (a UUIDArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	strs := make(pq.StringArray, len(a))
+	for i, id := range a {
+		strs[i] = id.String()
+	}
+	return strs.Value()
+}
+
+func (a *UUIDArray) Scan(src interface{}) error {
+	var strs pq.StringArray
+	if err := strs.Scan(src); err != nil {
+		return err
+	}
+	if strs == nil {
+		*a = nil
+		return nil
+	}
+	ids := make(UUIDArray, len(strs))
+	for i, s := range strs {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return err
+		}
+		ids[i] = id
+	}
+	*a = ids
+	return nil
+}
+
+// isArrayArg reports plain slices to be bound with pq.Array, the pq array types and UUIDArray,
+// byte slices and other types implementing driver.Valuer are passed as is
+func isArrayArg(v interface{}) bool {
+	switch v.(type) {
+	case pq.StringArray, pq.Int64Array, pq.Float64Array, pq.BoolArray, pq.ByteaArray, pq.GenericArray, UUIDArray:
+		return true
+	case driver.Valuer:
+		return false
+	}
+	t := reflect.TypeOf(v)
+	return t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+const (
+	// dalTagVersion marks the optimistic lock column, e.g.
+	//	Version int64 `db:"version" dal:"version"`
+	dalTagVersion = "version"
+
+	// OldVersionParam named parameter holding the version the entity was loaded with
+	OldVersionParam = "old_version"
+)
+
+// DoUpdateVersioned executes an optimistic locked update of the entity, the query updates the row without
+// touching the version column, e.g.
+//
+//	UPDATE users SET name = :name, updated_at = :updated_at WHERE id = :id
+//
+// and is rewritten to increment the column and to match the version the entity was loaded with:
+//
+//	UPDATE users SET name = :name, updated_at = :updated_at, version = version + 1 WHERE (id = :id) AND version = :old_version
+//
+// The version field of the entity is bumped accordingly. Zero affected rows means a stale write and results
+// in PreconditionFailedErr, the version and the auto timestamps of the entity are then restored to the loaded values.
+func (d *dal) DoUpdateVersioned(ctx context.Context, query string, entity interface{}) (sql.Result, error) {
+	field, column, err := versionField(entity)
+	if err != nil {
+		return nil, Wrap(err)
+	}
+	query, err = versionedQuery(query, column)
+	if err != nil {
+		return nil, Wrap(err)
+	}
+	oldVersion := field.Interface()
+	// shallow copy restoring the version and updated_at when the write does not happen
+	elem := reflect.ValueOf(entity).Elem()
+	loaded := reflect.New(elem.Type()).Elem()
+	loaded.Set(elem)
+	bumpVersion(field)
+	if d.autoTimestamps {
+		stampTimestamps(entity, ColumnUpdatedAt)
+	}
+
+	args := make(map[string]interface{})
+	for name, value := range d.Connection().Mapper.FieldMap(reflect.ValueOf(entity)) {
+		args[name] = value.Interface()
+	}
+	args[OldVersionParam] = oldVersion
+
+	result, err := d.DoUpdate(ctx, query, args)
+	affected, err := AffectedRows(result, err)
+	if err != nil {
+		elem.Set(loaded)
+		return result, err
+	}
+	if affected == 0 {
+		elem.Set(loaded)
+		return result, PreconditionFailedErr("Stale object version")
+	}
+	return result, nil
+}
+
+func versionField(entity interface{}) (reflect.Value, string, error) {
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return reflect.Value{}, "", fmt.Errorf("must pass a pointer to a stuct, %T", entity)
+	}
+	field, column, ok := findVersionField(v.Elem())
+	if !ok {
+		return reflect.Value{}, "", fmt.Errorf("no `dal:\"%s\"` tagged integer field in %T", dalTagVersion, entity)
+	}
+	return field, column, nil
+}
+
+func findVersionField(v reflect.Value) (reflect.Value, string, bool) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			if f, column, ok := findVersionField(fv); ok {
+				return f, column, true
+			}
+			continue
+		}
+		if field.Tag.Get(dalTagName) != dalTagVersion || !fv.CanSet() {
+			continue
+		}
+		switch fv.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			column := field.Tag.Get("db")
+			if column == "" {
+				column = strings.ToLower(field.Name)
+			}
+			return fv, column, true
+		}
+	}
+	return reflect.Value{}, "", false
+}
+
+func bumpVersion(field reflect.Value) {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		field.SetInt(field.Int() + 1)
+	default:
+		field.SetUint(field.Uint() + 1)
+	}
+}
+
+var setClauseRe = regexp.MustCompile(`(?is)^\s*UPDATE\s.*?\sSET\s`)
+
+// versionedQuery appends the version increment to the SET list and the old version condition to the WHERE clause
+func versionedQuery(query string, column string) (string, error) {
+	where := lastTopLevelKeyword(query, "WHERE")
+	if where < 0 {
+		return "", fmt.Errorf("versioned update must have a WHERE clause")
+	}
+	set := setClauseRe.FindStringIndex(query)
+	if set == nil || set[1] > where {
+		return "", fmt.Errorf("versioned update must be an UPDATE ... SET statement")
+	}
+	assignment := regexp.MustCompile(fmt.Sprintf(`(?i)(^|[\s,.])"?%s"?\s*=`, regexp.QuoteMeta(column)))
+	if assignment.MatchString(query[set[1]:where]) {
+		return "", fmt.Errorf("versioned update must not assign `%s`, it is incremented by DoUpdateVersioned", column)
+	}
+	end, tail := len(query), ""
+	if returning := lastTopLevelKeyword(query, "RETURNING"); returning > where {
+		end, tail = returning, " "+query[returning:]
+	}
+	condition := strings.TrimSpace(query[where+len("WHERE") : end])
+	return fmt.Sprintf("%s, %s = %s + 1 WHERE (%s) AND %s = :%s%s",
+		strings.TrimRight(query[:where], " \t\r\n"), column, column, condition, column, OldVersionParam, tail), nil
+}
+
+// lastTopLevelKeyword index of the last keyword outside literals, quoted identifiers and parentheses, -1 when absent
+func lastTopLevelKeyword(query string, keyword string) int {
+	found, depth := -1, 0
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"':
+			i = skipQuoted(query, i, c)
+			continue
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && (i == 0 || !isIdentChar(query[i-1])) && len(query)-i >= len(keyword) &&
+			strings.EqualFold(query[i:i+len(keyword)], keyword) &&
+			(i+len(keyword) == len(query) || !isIdentChar(query[i+len(keyword)])):
+			found = i
+			i += len(keyword)
+			continue
+		}
+		i++
+	}
+	return found
+}
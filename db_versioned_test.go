@@ -0,0 +1,20 @@
+package core
+
+import "testing"
+
+func TestVersionedQuery(t *testing.T) {
+	query, err := versionedQuery("UPDATE users SET name = :name WHERE id = :id OR slug = 'where' RETURNING updated_at", "version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "UPDATE users SET name = :name, version = version + 1 WHERE (id = :id OR slug = 'where') AND version = :old_version RETURNING updated_at"
+	if query != expected {
+		t.Errorf("expected %q, got %q", expected, query)
+	}
+	if _, err := versionedQuery("UPDATE users SET name = :name, version = :version WHERE id = :id", "version"); err == nil {
+		t.Error("expected an error for a query assigning the version column")
+	}
+	if _, err := versionedQuery("UPDATE users SET name = :name", "version"); err == nil {
+		t.Error("expected an error for a query without WHERE")
+	}
+}
@@ -1,13 +1,15 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io/fs"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"reflect"
 	"regexp"
 	"runtime"
@@ -16,12 +18,19 @@ import (
 	"time"
 
 	"github.com/fatih/color"
-	"github.com/sirupsen/logrus"
-	logger "github.com/sirupsen/logrus"
+	"github.com/valyala/fasthttp"
 )
 
 const profileContextKey = "punqy-profile"
 
+var (
+	queryWhitespaceRe = regexp.MustCompile("\\s{2,}")
+	queryStringRe     = regexp.MustCompile(`'(?:[^']|'')*'`)
+	queryNumberRe     = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	queryParamRe      = regexp.MustCompile(`\$\d+`)
+	queryInListRe     = regexp.MustCompile(`(?i)\bIN\s*\([^()]*\)`)
+)
+
 type qp []sqlQueryProfile
 
 func (p qp) ByDateTime() []sqlQueryProfile {
@@ -50,6 +59,10 @@ type sqlQueryProfile struct {
 	Args     []interface{} `json:"args"`
 	DateTime time.Time     `json:"date_time"`
 	Hash     string        `json:"hash"`
+	// Tag component which issued the query, see WithQueryTag
+	Tag string `json:"tag,omitempty"`
+	// Plan EXPLAIN (FORMAT JSON) output, see DalConfig.ExplainQueries
+	Plan json.RawMessage `json:"plan,omitempty"`
 }
 
 func (q sqlQueryProfile) GetQuery() string {
@@ -149,22 +162,65 @@ func (l *Profile) QueryProfiles() []sqlQueryProfile {
 	return l.SqlQueries
 }
 
-func (l *Profile) AddQueryProfile(query string, dur float64, args []interface{}) {
+func (l *Profile) AddQueryProfile(query string, dur float64, args []interface{}, tag ...string) {
 	qp := sqlQueryProfile{
-		Query:    regexp.MustCompile("\\s{2,}").ReplaceAllString(query, " "),
+		Query:    queryWhitespaceRe.ReplaceAllString(query, " "),
 		Duration: dur,
 		Args:     args,
 		DateTime: time.Now().UTC(),
 	}
+	if len(tag) > 0 {
+		qp.Tag = tag[0]
+	}
 	hash := md5.Sum([]byte(qp.Query))
 	qp.Hash = hex.EncodeToString(hash[:])
 	l.SqlQueries = append(l.SqlQueries, qp)
 }
 
+type QueryGroup struct {
+	Query    string  `json:"query"`
+	Count    int     `json:"count"`
+	Duration float64 `json:"duration"`
+	// Tags distinct query tags of the group
+	Tags []string `json:"tags,omitempty"`
+}
+
+// GroupedQueries aggregates queries by shape, literals and IN lists collapsed, sorted by total time
+func (l *Profile) GroupedQueries() []QueryGroup {
+	index := make(map[string]int)
+	groups := make([]QueryGroup, 0)
+	for _, q := range l.SqlQueries {
+		shape := normalizeQuery(q.Query)
+		i, ok := index[shape]
+		if !ok {
+			i = len(groups)
+			index[shape] = i
+			groups = append(groups, QueryGroup{Query: shape})
+		}
+		groups[i].Count++
+		groups[i].Duration += q.Duration
+		if q.Tag != "" && !StringsContains(groups[i].Tags, q.Tag) {
+			groups[i].Tags = append(groups[i].Tags, q.Tag)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Duration > groups[j].Duration
+	})
+	return groups
+}
+
+func normalizeQuery(query string) string {
+	query = queryStringRe.ReplaceAllString(query, "?")
+	query = queryParamRe.ReplaceAllString(query, "?")
+	query = queryNumberRe.ReplaceAllString(query, "?")
+	query = queryInListRe.ReplaceAllString(query, "IN (?)")
+	return strings.TrimSpace(queryWhitespaceRe.ReplaceAllString(query, " "))
+}
+
 func (l *Profile) AddEventDispatcherProfile(evt string, dur float64, subs EventSubscribers) {
 	names := make([]string, len(subs))
 	for i, s := range subs {
-		names[i] = strings.Replace(runtime.FuncForPC(reflect.ValueOf(s).Pointer()).Name(), "-fm", "", 1)
+		names[i] = subscriberName(s)
 	}
 	ep := EventProfile{
 		DateTime:    time.Now().UTC(),
@@ -193,7 +249,7 @@ func (l Profile) TotalQExecTimeString() string {
 
 func (l *Profile) PrintQueryLog() {
 	for _, ql := range l.SqlQueries {
-		logrus.Infof("%s [%.4f.s]", ql.Query, ql.Duration)
+		GetLogger().Info(ql.Query, Fields{"duration": ql.Duration})
 	}
 }
 
@@ -242,25 +298,20 @@ func (m *profilerManager) List() ([]Profile, error) {
 			return []Profile{}, err
 		}
 	}
-	var profiles = make([]Profile, len(files))
+	var profiles = make([]Profile, 0, len(files))
 	sort.SliceStable(files, func(i, j int) bool {
 		return files[i].Name() > files[j].Name()
 	})
-	total := len(files)
-	if total == 0 {
-		return profiles, nil
-	}
-
-	for i, file := range files {
-		marshaled, err := os.ReadFile(fmt.Sprintf("%s/%s", m.profileDir, file.Name()))
-		if err != nil {
-			return profiles, nil
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
 		}
-		var profile Profile
-		if err := json.Unmarshal(marshaled, &profile); err != nil {
-			return profiles, err
+		profile, err := m.readProfile(file.Name())
+		if err != nil {
+			GetLogger().Warn("Skipping unreadable profile", Fields{"file": file.Name(), "error": err.Error()})
+			continue
 		}
-		profiles[i] = profile
+		profiles = append(profiles, profile)
 	}
 	return profiles, nil
 }
@@ -274,14 +325,30 @@ func (m *profilerManager) Last() (Profile, error) {
 	sort.SliceStable(files, func(i, j int) bool {
 		return files[i].Name() > files[j].Name()
 	})
-	if len(files) == 0 {
-		return p, nil
+	var lastErr error
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".json" {
+			continue
+		}
+		profile, err := m.readProfile(file.Name())
+		if err != nil {
+			// a corrupt newest file should not hide the previous profile
+			GetLogger().Warn("Skipping unreadable profile", Fields{"file": file.Name(), "error": err.Error()})
+			lastErr = err
+			continue
+		}
+		return profile, nil
 	}
-	marshaled, err := os.ReadFile(fmt.Sprintf("%s/%s", m.profileDir, files[0].Name()))
+	return p, lastErr
+}
+
+func (m *profilerManager) readProfile(name string) (Profile, error) {
+	var p Profile
+	marshaled, err := os.ReadFile(fmt.Sprintf("%s/%s", m.profileDir, name))
 	if err != nil {
 		return p, err
 	}
-	if err := json.Unmarshal(marshaled, &p); err != nil {
+	if err := unmarshalJSON(marshaled, &p); err != nil {
 		return p, err
 	}
 	return p, nil
@@ -289,43 +356,96 @@ func (m *profilerManager) Last() (Profile, error) {
 
 func (m *profilerManager) Get(id string) (Profile, error) {
 	var p Profile
-	marshaled, err := os.ReadFile(fmt.Sprintf("%s/%s.json", m.profileDir, id))
+	fileName, err := m.fileNameById(id)
 	if err != nil {
 		return p, err
 	}
-	if err := json.Unmarshal(marshaled, &p); err != nil {
+	marshaled, err := os.ReadFile(fileName)
+	if err != nil {
+		return p, err
+	}
+	if err := unmarshalJSON(marshaled, &p); err != nil {
 		return p, err
 	}
 	return p, nil
 }
 
+// fileNameById profiles are stored as <unix nano>_<id>.json so file names sort by time
+func (m *profilerManager) fileNameById(id string) (string, error) {
+	matches, err := filepath.Glob(fmt.Sprintf("%s/*_%s.json", m.profileDir, filepath.Base(id)))
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return fmt.Sprintf("%s/%s.json", m.profileDir, filepath.Base(id)), nil
+	}
+	return matches[0], nil
+}
+
 func (m *profilerManager) Save(profile Profile) error {
 	if err := os.MkdirAll(m.profileDir, 0755); err != nil {
 		return err
 	}
-
-	fileName := fmt.Sprintf("%s/%v.json", m.profileDir, profile.DateTime.Unix())
-	file, err := os.Create(fileName)
+	compact, err := marshalJSON(profile)
 	if err != nil {
 		return err
 	}
-	if err := file.Close(); err != nil {
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, compact, "", "	"); err != nil {
 		return err
 	}
-	marshaled, err := json.MarshalIndent(profile, "", "	")
-
-	if err := ioutil.WriteFile(file.Name(), marshaled, fs.ModeDevice); err != nil {
+	marshaled := indented.Bytes()
+	// write to a temp file first and rename it into place, so a crash mid-write never leaves a partial profile
+	tmp, err := ioutil.TempFile(m.profileDir, ".profile-*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(marshaled); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	fileName := fmt.Sprintf("%s/%d_%s.json", m.profileDir, profile.DateTime.UnixNano(), profile.Id)
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		os.Remove(tmp.Name())
 		return err
 	}
 	return nil
 }
 
+// WithProfile attaches the profile to ctx, the DAL and event dispatcher accumulate timings into it
+func WithProfile(ctx context.Context, profile *Profile) context.Context {
+	return ProfileValue.WithValue(ctx, profile)
+}
+
+// ProfileFromContext returns the profile collected for the request or attached with WithProfile
+func ProfileFromContext(ctx context.Context) (*Profile, bool) {
+	profile, ok := ProfileValue.Get(ctx)
+	return profile, ok
+}
+
 type HttpProfilerMiddleware interface {
 	Handle(req Request, next Handler) Response
 }
 
+type ProfilerConfig struct {
+	// Collect attaches a profile to every request without saving or logging it
+	Collect bool
+	// Save collects and saves profiles with the manager, implies Collect
+	Save bool
+}
+
 type middleware struct {
 	enabled bool
+	save    bool
 	manager ProfilerManager
 	colors  colors
 }
@@ -341,8 +461,14 @@ type colors struct {
 }
 
 func NewProfilerMiddleware(enabled bool, manager ProfilerManager) HttpProfilerMiddleware {
+	return NewProfilerMiddlewareWithConfig(ProfilerConfig{Save: enabled}, manager)
+}
+
+// NewProfilerMiddlewareWithConfig manager may be nil when profiles are only collected
+func NewProfilerMiddlewareWithConfig(config ProfilerConfig, manager ProfilerManager) HttpProfilerMiddleware {
 	return &middleware{
-		enabled: enabled,
+		enabled: config.Collect || config.Save,
+		save:    config.Save && manager != nil,
 		manager: manager,
 		colors: colors{
 			red:    color.New(color.FgRed).SprintFunc(),
@@ -360,7 +486,7 @@ func (m *middleware) Handle(req Request, next Handler) Response {
 	if !m.enabled {
 		return next(req)
 	}
-	route, ok := req.UserValue(RequestValueRoute).(Route)
+	route, ok := RouteValue.Get(req)
 	if !ok {
 		return next(req)
 	}
@@ -372,30 +498,30 @@ func (m *middleware) Handle(req Request, next Handler) Response {
 	runtime.ReadMemStats(&msb)
 
 	profile := NewProfile(req.Time())
-	req.RequestCtx.SetUserValue(profileContextKey, &profile)
+	profile.Id = req.RequestID()
+	ProfileValue.Set(req, &profile)
+	defer func() {
+		rec := recover()
+		if rec == nil {
+			return
+		}
+		stack := panicFrames()
+		rec, stack = unwrapPanic(rec, stack)
+		// stored before the recovery answers, a panicking request is the one worth profiling
+		profile.ResponseCode = fasthttp.StatusInternalServerError
+		profile.ResponseErr = fmt.Sprint(rec)
+		profile.ErrTrace = stack
+		m.store(req, &profile, handler, msb, nil)
+		panic(recoveredPanic{value: rec, stack: stack})
+	}()
 	resp := next(req)
-
-	var msa runtime.MemStats
-	runtime.ReadMemStats(&msa)
-
-	profile.RequestDuration = time.Now().Sub(req.Time()).Seconds()
-	profile.MemoryUsed = (msa.TotalAlloc - msb.TotalAlloc) / 1024
-	profile.RemoteAddr = req.RemoteAddr().String()
-	profile.RequestMethod = string(req.Method())
-	profile.RequestBody = string(req.PostBody())
-	profile.ResponseCode = resp.GetCode()
-	profile.RequestURI = req.URI().String()
-	profile.RequestHandler = handler
-	req.Request.Header.VisitAll(func(key, value []byte) {
-		profile.RequestHeaders[string(key)] = string(value)
-	})
 	if err := resp.GetError(); err != nil {
 		if stackErr, ok := err.(StackTracer); ok {
 			profile.ErrTrace = make([]Frame, 0)
 			for _, frame := range stackErr.StackTrace()[1:] {
 				text, err := frame.MarshalText()
 				if err != nil {
-					return nil
+					break
 				}
 				frameVal := strings.Split(string(text), " ")
 				fileLine := strings.Split(frameVal[1], ":")
@@ -408,20 +534,43 @@ func (m *middleware) Handle(req Request, next Handler) Response {
 		}
 		profile.ResponseErr = resp.GetError().Error()
 	}
+	profile.ResponseCode = resp.GetCode()
+	m.store(req, &profile, handler, msb, resp)
+	return resp
+}
+
+// store completes the profile with the request data and saves it, resp is nil when the handler panicked
+func (m *middleware) store(req Request, profile *Profile, handler string, msb runtime.MemStats, resp Response) {
+	var msa runtime.MemStats
+	runtime.ReadMemStats(&msa)
 
-	if err := m.manager.Save(profile); err != nil {
-		logger.Error(err)
-		return resp
+	profile.RequestDuration = time.Now().Sub(req.Time()).Seconds()
+	profile.MemoryUsed = (msa.TotalAlloc - msb.TotalAlloc) / 1024
+	profile.RemoteAddr = req.RemoteAddr().String()
+	profile.RequestMethod = string(req.Method())
+	profile.RequestBody = string(req.PostBody())
+	profile.RequestURI = req.URI().String()
+	profile.RequestHandler = handler
+	req.Request.Header.VisitAll(func(key, value []byte) {
+		profile.RequestHeaders[string(key)] = string(value)
+	})
+
+	if !m.save {
+		return
 	}
-	req.Response.Header.Add("x-request-profile-id", profile.Id)
-	logger.WithFields(logger.Fields{
+	if err := m.manager.Save(*profile); err != nil {
+		req.Logger().Error("profile save failed", Fields{"error": err.Error()})
+		return
+	}
+	if resp == nil || !isTimedOut(resp) {
+		req.Response.Header.Add("x-request-profile-id", profile.Id)
+	}
+	req.Logger().Info(profile.RequestHandler, Fields{
 		profile.RequestMethod: profile.ResponseCode,
 		"PID":                 profile.Id,
 		"URI":                 profile.RequestURI,
 		"IP":                  profile.RemoteAddr,
 		"MEM":                 fmt.Sprintf("%d kib", profile.MemoryUsed),
 		"DUR":                 fmt.Sprintf("%.4f.s", profile.RequestDuration),
-	}).Infof(profile.RequestHandler)
-
-	return resp
+	})
 }
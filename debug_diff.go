@@ -0,0 +1,42 @@
+package core
+
+// ProfileDiff deltas are b minus a, positive values mean b got slower or bigger
+type ProfileDiff struct {
+	RequestDuration float64  `json:"request_duration"`
+	QueryTime       float64  `json:"query_time"`
+	QueryCount      int      `json:"query_count"`
+	MemoryUsed      int64    `json:"memory_used"`
+	OnlyInA         []string `json:"only_in_a"`
+	OnlyInB         []string `json:"only_in_b"`
+}
+
+// DiffProfiles compares two profiles, queries are matched by their shape (literals, placeholders
+// and whitespace normalized as in GroupedQueries)
+func DiffProfiles(a, b Profile) ProfileDiff {
+	return ProfileDiff{
+		RequestDuration: b.RequestDuration - a.RequestDuration,
+		QueryTime:       b.TotalQExecTime() - a.TotalQExecTime(),
+		QueryCount:      len(b.SqlQueries) - len(a.SqlQueries),
+		MemoryUsed:      int64(b.MemoryUsed) - int64(a.MemoryUsed),
+		OnlyInA:         missingQueries(a.SqlQueries, b.SqlQueries),
+		OnlyInB:         missingQueries(b.SqlQueries, a.SqlQueries),
+	}
+}
+
+// missingQueries distinct queries of from which are absent in other
+func missingQueries(from, other qp) []string {
+	known := make(map[string]bool, len(other))
+	for _, q := range other {
+		known[normalizeQuery(q.Query)] = true
+	}
+	missing := make([]string, 0)
+	for _, q := range from {
+		shape := normalizeQuery(q.Query)
+		if known[shape] {
+			continue
+		}
+		known[shape] = true
+		missing = append(missing, q.Query)
+	}
+	return missing
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+)
+
+const DefaultProfilerCapacity = 60
+
+type memoryProfilerManager struct {
+	mu       sync.RWMutex
+	capacity int
+	// profiles ring buffer, next is the slot to be written
+	profiles []Profile
+	next     int
+	size     int
+}
+
+// NewMemoryProfilerManager keeps the last capacity profiles in memory, useful for tests
+func NewMemoryProfilerManager(capacity ...int) ProfilerManager {
+	c := DefaultProfilerCapacity
+	if len(capacity) > 0 && capacity[0] > 0 {
+		c = capacity[0]
+	}
+	return &memoryProfilerManager{capacity: c, profiles: make([]Profile, c)}
+}
+
+func (m *memoryProfilerManager) Save(profile Profile) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.profiles[m.next] = profile
+	m.next = (m.next + 1) % m.capacity
+	if m.size < m.capacity {
+		m.size++
+	}
+	return nil
+}
+
+// List returns profiles newest first
+func (m *memoryProfilerManager) List() ([]Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	profiles := make([]Profile, m.size)
+	for i := 0; i < m.size; i++ {
+		profiles[i] = m.profiles[(m.next-1-i+m.capacity)%m.capacity]
+	}
+	return profiles, nil
+}
+
+func (m *memoryProfilerManager) Last() (Profile, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.size == 0 {
+		return Profile{}, nil
+	}
+	return m.profiles[(m.next-1+m.capacity)%m.capacity], nil
+}
+
+func (m *memoryProfilerManager) Get(id string) (Profile, error) {
+	profiles, _ := m.List()
+	for _, p := range profiles {
+		if p.Id == id {
+			return p, nil
+		}
+	}
+	return Profile{}, ObjectNotFoundErr(fmt.Sprintf("profile %s", id))
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// newTestProfilerManager saves two profiles and a malformed file newer than both
+func newTestProfilerManager(t *testing.T) ProfilerManager {
+	dir := t.TempDir()
+	manager := NewManager(dir)
+	start := time.Now()
+	for i, id := range []string{"older", "newer"} {
+		if err := manager.Save(Profile{Id: id, DateTime: start.Add(time.Duration(i) * time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	malformed := fmt.Sprintf("%s/profile/%d_broken.json", dir, start.Add(time.Minute).UnixNano())
+	if err := os.WriteFile(malformed, []byte("{not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestProfilerListSkipsMalformedProfile(t *testing.T) {
+	manager := newTestProfilerManager(t)
+
+	profiles, err := manager.List()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(profiles) != 2 || profiles[0].Id != "newer" || profiles[1].Id != "older" {
+		t.Errorf("expected the newer and older profiles, got %+v", profiles)
+	}
+}
+
+func TestProfilerLastFallsBackToNextNewest(t *testing.T) {
+	manager := newTestProfilerManager(t)
+
+	profile, err := manager.Last()
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if profile.Id != "newer" {
+		t.Errorf("expected the newest readable profile, got %q", profile.Id)
+	}
+}
+
+func TestDiffProfilesMatchesNormalizedQueries(t *testing.T) {
+	var a, b Profile
+	a.AddQueryProfile("SELECT * FROM users WHERE id = 1 AND name = 'a'", 0.1, nil)
+	a.AddQueryProfile("SELECT * FROM orders WHERE user_id = $1", 0.1, nil)
+	b.AddQueryProfile("SELECT *\n\tFROM users WHERE id = 42 AND name = 'it''s'", 0.1, nil)
+	b.AddQueryProfile("SELECT * FROM \"orders2\" WHERE user_id = $1", 0.1, nil)
+
+	diff := DiffProfiles(a, b)
+	if len(diff.OnlyInA) != 1 || diff.OnlyInA[0] != "SELECT * FROM orders WHERE user_id = $1" {
+		t.Errorf("expected only the orders query in a, got %v", diff.OnlyInA)
+	}
+	if len(diff.OnlyInB) != 1 || diff.OnlyInB[0] != "SELECT * FROM \"orders2\" WHERE user_id = $1" {
+		t.Errorf("expected only the orders2 query in b, got %v", diff.OnlyInB)
+	}
+}
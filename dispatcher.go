@@ -2,11 +2,14 @@ package core
 
 import (
 	"context"
+	"fmt"
+	"reflect"
 	"sort"
 	"time"
 
 	"github.com/cornelk/hashmap"
 	"github.com/pkg/errors"
+	"go.uber.org/multierr"
 )
 
 type ErrEventStopped struct{}
@@ -15,6 +18,35 @@ func (e ErrEventStopped) Error() string {
 	return "Event stopped"
 }
 
+type ErrSubscriberPanic struct {
+	Event string
+	Value interface{}
+	Stack []Frame
+}
+
+func (e ErrSubscriberPanic) Error() string {
+	return fmt.Sprintf("Event %s subscriber panic: %v", e.Event, e.Value)
+}
+
+type ErrSubscriberTimeout struct {
+	Event   string
+	Timeout time.Duration
+}
+
+func (e ErrSubscriberTimeout) Error() string {
+	return fmt.Sprintf("Event %s subscriber timed out after %s", e.Event, e.Timeout)
+}
+
+type ErrUnexpectedEvent struct {
+	Event    string
+	Type     string
+	Expected string
+}
+
+func (e ErrUnexpectedEvent) Error() string {
+	return fmt.Sprintf("Event %s is %s, subscriber expects %s", e.Event, e.Type, e.Expected)
+}
+
 type Event interface {
 	GetName() string
 }
@@ -37,14 +69,51 @@ type ListenerEntry struct {
 
 type EventDispatcherConfig []ListenerEntry
 
+type DispatcherOptions struct {
+	Debug bool
+	// ContinueOnPanic keeps dispatching to the remaining subscribers
+	// when one of them panics, otherwise the panic is returned as an error.
+	ContinueOnPanic bool
+	// DispatchPanics dispatches a PanicEvent for every subscriber panic,
+	// panics of PanicEventName subscribers themselves are only logged
+	DispatchPanics bool
+	// SubscriberTimeout bounds every subscriber call, the subscriber context is canceled and
+	// ErrSubscriberTimeout returned while the subscriber keeps running in the background. Zero disables it.
+	SubscriberTimeout time.Duration
+	// CollectErrors calls the remaining subscribers after a failing one and returns all errors combined
+	// (multierr), fail-fast otherwise. ErrEventStopped ends the dispatch in both modes.
+	CollectErrors bool
+	// HistorySize number of recent dispatches kept in debug mode, DefaultEventHistorySize by default,
+	// negative disables the history. See EventHistory.
+	HistorySize int
+}
+
 type dispatcher struct {
-	subscribers hashmap.HashMap
-	debug       bool
+	subscribers     hashmap.HashMap
+	debug           bool
+	continueOnPanic bool
+	dispatchPanics  bool
+	timeout         time.Duration
+	collectErrors   bool
+	history         *eventHistory
 }
 
 func NewDispatcher(debug bool) EventDispatcher {
+	return NewDispatcherWithOptions(DispatcherOptions{Debug: debug})
+}
+
+func NewDispatcherWithOptions(opts DispatcherOptions) EventDispatcher {
+	var history *eventHistory
+	if opts.Debug && opts.HistorySize >= 0 {
+		history = newEventHistory(opts.HistorySize)
+	}
 	return &dispatcher{
-		debug: debug,
+		history:         history,
+		debug:           opts.Debug,
+		continueOnPanic: opts.ContinueOnPanic,
+		dispatchPanics:  opts.DispatchPanics,
+		timeout:         opts.SubscriberTimeout,
+		collectErrors:   opts.CollectErrors,
 	}
 }
 
@@ -57,6 +126,20 @@ func (d *dispatcher) Configure(cfg EventDispatcherConfig) {
 	}
 }
 
+// On subscribes fn to the events named name asserting them to T once,
+// an event of another type fails the dispatch with ErrUnexpectedEvent:
+//
+//	core.On(dispatcher, core.AfterAuthEventName, func(ctx context.Context, e core.AfterAuthenticateEvent) error {...})
+func On[T Event](dispatcher EventDispatcher, name string, fn func(ctx context.Context, event T) error) {
+	dispatcher.Subscribe(name, func(ctx context.Context, event Event) error {
+		typed, ok := event.(T)
+		if !ok {
+			return ErrUnexpectedEvent{Event: name, Type: fmt.Sprintf("%T", event), Expected: reflect.TypeOf((*T)(nil)).Elem().String()}
+		}
+		return fn(ctx, typed)
+	})
+}
+
 func (d *dispatcher) Subscribe(evt string, subscriber EventSubscriber) {
 	var s = []EventSubscriber{subscriber}
 	subs, ok := d.subscribers.Get(evt)
@@ -68,13 +151,18 @@ func (d *dispatcher) Subscribe(evt string, subscriber EventSubscriber) {
 }
 
 func (d *dispatcher) Dispatch(ctx context.Context, event Event) error {
+	var record *EventRecord
+	if d.history != nil {
+		record = &EventRecord{DateTime: time.Now().UTC(), EventName: event.GetName(), Event: event}
+		defer d.history.add(record)
+	}
 	subs, ok := d.subscribers.Get(event.GetName())
 	if !ok {
 		return nil
 	}
 	s := subs.([]EventSubscriber)
 	if d.debug {
-		profile, ok := ctx.Value(profileContextKey).(*Profile)
+		profile, ok := ProfileValue.Get(ctx)
 		if ok {
 			start := time.Now()
 			defer func(ctx context.Context) {
@@ -83,19 +171,77 @@ func (d *dispatcher) Dispatch(ctx context.Context, event Event) error {
 		}
 	}
 
-	return d.doDispatch(ctx, event, s)
+	return d.doDispatch(ctx, event, s, record)
 }
 
-func (d *dispatcher) doDispatch(ctx context.Context, event Event, subs []EventSubscriber) error {
+// doDispatch fills the history record when given
+func (d *dispatcher) doDispatch(ctx context.Context, event Event, subs []EventSubscriber, record *EventRecord) (errs error) {
+	if record != nil {
+		start := time.Now()
+		defer func() {
+			record.Duration = time.Since(start).Seconds()
+			if errs != nil {
+				record.Error = errs.Error()
+			}
+		}()
+	}
 	for _, sub := range subs {
-		if err := sub(ctx, event); err != nil {
+		if record != nil {
+			record.Subscribers = append(record.Subscribers, subscriberName(sub))
+		}
+		if err := d.callSubscriberTimeout(ctx, event, sub); err != nil {
 			if errors.As(err, &ErrEventStopped{}) {
+				if record != nil {
+					record.Stopped = true
+				}
 				break
 			}
-			return err
+			if errors.As(err, &ErrSubscriberPanic{}) && d.continueOnPanic {
+				continue
+			}
+			if !d.collectErrors {
+				return err
+			}
+			errs = multierr.Append(errs, err)
 		}
 	}
-	return nil
+	return errs
+}
+
+func (d *dispatcher) callSubscriberTimeout(ctx context.Context, event Event, sub EventSubscriber) error {
+	if d.timeout <= 0 {
+		return d.callSubscriber(ctx, event, sub)
+	}
+	subCtx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- d.callSubscriber(subCtx, event, sub)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-subCtx.Done():
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		LoggerFromContext(ctx).Warn(fmt.Sprintf("event %s subscriber timed out after %s", event.GetName(), d.timeout))
+		return ErrSubscriberTimeout{Event: event.GetName(), Timeout: d.timeout}
+	}
+}
+
+func (d *dispatcher) callSubscriber(ctx context.Context, event Event, sub EventSubscriber) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			stack := panicFrames()
+			LoggerFromContext(ctx).Error(fmt.Sprintf("event %s subscriber recovered from: %v", event.GetName(), rec), Fields{"stack": stack})
+			err = ErrSubscriberPanic{Event: event.GetName(), Value: rec, Stack: stack}
+			if d.dispatchPanics && event.GetName() != PanicEventName {
+				dispatchPanicEvent(ctx, d, NewSubscriberPanicEvent(ctx, event.GetName(), rec, stack))
+			}
+		}
+	}()
+	return sub(ctx, event)
 }
 
 func dispatchEventSilent(ctx context.Context, dispatcher EventDispatcher, event Event) error {
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultEventHistorySize = 100
+
+// EventRecord a dispatch kept in the dispatcher history, Subscribers are the ones called in order,
+// the one returning ErrEventStopped or failing fast being the last
+type EventRecord struct {
+	DateTime    time.Time `json:"dateTime"`
+	EventName   string    `json:"eventName"`
+	Event       Event     `json:"event"`
+	Duration    float64   `json:"duration"`
+	Subscribers []string  `json:"subscribers"`
+	Stopped     bool      `json:"stopped"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// EventHistory implemented by the dispatcher, the history is only kept in debug mode
+type EventHistory interface {
+	// History recent dispatches, oldest first
+	History() []EventRecord
+}
+
+func (d *dispatcher) History() []EventRecord {
+	if d.history == nil {
+		return nil
+	}
+	return d.history.records()
+}
+
+// eventHistory ring buffer of the last size records
+type eventHistory struct {
+	mu      sync.Mutex
+	entries []EventRecord
+	next    int
+	full    bool
+}
+
+func newEventHistory(size int) *eventHistory {
+	if size <= 0 {
+		size = DefaultEventHistorySize
+	}
+	return &eventHistory{entries: make([]EventRecord, size)}
+}
+
+func (h *eventHistory) add(record *EventRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.entries[h.next] = *record
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *eventHistory) records() []EventRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.full {
+		return append([]EventRecord(nil), h.entries[:h.next]...)
+	}
+	return append(append([]EventRecord(nil), h.entries[h.next:]...), h.entries[:h.next]...)
+}
+
+func subscriberName(s EventSubscriber) string {
+	return strings.Replace(runtime.FuncForPC(reflect.ValueOf(s).Pointer()).Name(), "-fm", "", 1)
+}
@@ -0,0 +1,60 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type testEvent struct{}
+
+func (testEvent) GetName() string {
+	return "test.event"
+}
+
+func subscribePanicking(d EventDispatcher, called *[]string) {
+	d.Subscribe("test.event", func(ctx context.Context, event Event) error {
+		*called = append(*called, "first")
+		return nil
+	})
+	d.Subscribe("test.event", func(ctx context.Context, event Event) error {
+		*called = append(*called, "panicking")
+		panic("boom")
+	})
+	d.Subscribe("test.event", func(ctx context.Context, event Event) error {
+		*called = append(*called, "last")
+		return nil
+	})
+}
+
+func TestDispatchStopsOnSubscriberPanic(t *testing.T) {
+	var called []string
+	d := NewDispatcherWithOptions(DispatcherOptions{})
+	subscribePanicking(d, &called)
+
+	err := d.Dispatch(context.Background(), testEvent{})
+
+	var panicErr ErrSubscriberPanic
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("expected ErrSubscriberPanic, got %v", err)
+	}
+	if panicErr.Event != "test.event" || panicErr.Value != "boom" {
+		t.Errorf("unexpected panic error %+v", panicErr)
+	}
+	if len(called) != 2 || called[1] != "panicking" {
+		t.Errorf("expected dispatch to stop after the panicking subscriber, called %v", called)
+	}
+}
+
+func TestDispatchContinuesOnSubscriberPanic(t *testing.T) {
+	var called []string
+	d := NewDispatcherWithOptions(DispatcherOptions{ContinueOnPanic: true})
+	subscribePanicking(d, &called)
+
+	if err := d.Dispatch(context.Background(), testEvent{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(called) != 3 || called[2] != "last" {
+		t.Errorf("expected all subscribers to run, called %v", called)
+	}
+}
@@ -242,6 +242,96 @@ func PreconditionFailedErr(message ...string) error {
 
 //======================================================================================================================
 
+type BadGateway struct {
+	message string
+}
+
+func (e BadGateway) GetCode() int {
+	return http.StatusBadGateway
+}
+
+func (e BadGateway) Error() string {
+	return e.message
+}
+
+func BadGatewayErr(message ...string) error {
+	return wrapErr(BadGateway{message: JoinStrings("Bad gateway", message...)})
+}
+
+//======================================================================================================================
+
+type RequestEntityTooLarge struct {
+	message string
+}
+
+func (e RequestEntityTooLarge) GetCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+func (e RequestEntityTooLarge) Error() string {
+	return e.message
+}
+
+func RequestEntityTooLargeErr(message ...string) error {
+	return wrapErr(RequestEntityTooLarge{message: JoinStrings("Request entity too large", message...)})
+}
+
+//======================================================================================================================
+
+type UnsupportedMediaType struct {
+	message string
+}
+
+func (e UnsupportedMediaType) GetCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+func (e UnsupportedMediaType) Error() string {
+	return e.message
+}
+
+func UnsupportedMediaTypeErr(message ...string) error {
+	return wrapErr(UnsupportedMediaType{message: JoinStrings("Unsupported media type", message...)})
+}
+
+//======================================================================================================================
+
+type GatewayTimeout struct {
+	message string
+}
+
+func (e GatewayTimeout) GetCode() int {
+	return http.StatusGatewayTimeout
+}
+
+func (e GatewayTimeout) Error() string {
+	return e.message
+}
+
+func GatewayTimeoutErr(message ...string) error {
+	return wrapErr(GatewayTimeout{message: JoinStrings("Gateway timeout", message...)})
+}
+
+//======================================================================================================================
+
+type ServiceUnavailable struct {
+	message string
+}
+
+func (e ServiceUnavailable) GetCode() int {
+	return http.StatusServiceUnavailable
+}
+
+func (e ServiceUnavailable) Error() string {
+	return e.message
+}
+
+func ServiceUnavailableErr(message ...string) error {
+	return wrapErr(ServiceUnavailable{message: JoinStrings("Service unavailable", message...)})
+}
+
+//======================================================================================================================
+
 func ValidationError(structPtr interface{}, fieldPtr interface{}, msg string) error {
 	return validation.ValidateStruct(structPtr,
 		validation.Field(fieldPtr,
@@ -251,3 +341,21 @@ func ValidationError(structPtr interface{}, fieldPtr interface{}, msg string) er
 		),
 	)
 }
+
+// FieldError single field validation error, rendered as 422 by NewErrorJSONResponse and NewValidationErrJsonResponse
+func FieldError(field string, message string) validation.Errors {
+	return validation.Errors{field: errors.New(message)}
+}
+
+// ValidationErrors field to message validation errors, keep the result typed when it may be empty:
+// a nil validation.Errors stored in an error interface is not nil
+func ValidationErrors(fields map[string]string) validation.Errors {
+	if len(fields) == 0 {
+		return nil
+	}
+	errs := make(validation.Errors, len(fields))
+	for field, message := range fields {
+		errs[field] = errors.New(message)
+	}
+	return errs
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"time"
+)
+
+// Access log field names, see AccessLogConfig.Fields
+const (
+	AccessLogMethod     = "method"
+	AccessLogPath       = "path"
+	AccessLogRoute      = "route"
+	AccessLogStatus     = "status"
+	AccessLogDuration   = "duration"
+	AccessLogBytes      = "bytes"
+	AccessLogRemoteAddr = "remote_addr"
+	AccessLogUserID     = "user_id"
+	AccessLogUserAgent  = "user_agent"
+)
+
+var defaultAccessLogFields = []string{
+	AccessLogMethod, AccessLogPath, AccessLogRoute, AccessLogStatus, AccessLogDuration,
+	AccessLogBytes, AccessLogRemoteAddr, AccessLogUserID,
+}
+
+type AccessLogEntry struct {
+	Method   string
+	Path     string
+	Route    string
+	Status   int
+	Duration time.Duration
+	// Bytes response body size, -1 for streamed responses
+	Bytes      int
+	RemoteAddr string
+	UserID     string
+	UserAgent  string
+}
+
+type AccessLogConfig struct {
+	// Logger defaults to the request logger (carrying the request id)
+	Logger Logger
+	// Fields logged as structured fields, all but user_agent by default
+	Fields []string
+	// Format renders the log message, "METHOD path status" by default
+	Format func(entry AccessLogEntry) string
+}
+
+// NewAccessLogMiddleware logs one structured line per request, meant to be always on,
+// unlike the profiler. Register it outside of the firewall to see the authenticated user.
+func NewAccessLogMiddleware(config ...AccessLogConfig) Middleware {
+	var cfg AccessLogConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.Fields) == 0 {
+		cfg.Fields = defaultAccessLogFields
+	}
+	if cfg.Format == nil {
+		cfg.Format = func(e AccessLogEntry) string {
+			return fmt.Sprintf("%s %s %d", e.Method, e.Path, e.Status)
+		}
+	}
+	return func(req Request, next Handler) Response {
+		start := time.Now()
+		resp := next(req)
+
+		entry := AccessLogEntry{
+			Method:     string(req.Method()),
+			Path:       string(req.Path()),
+			Route:      req.Route().Pattern(),
+			Status:     resp.GetCode(),
+			Duration:   time.Since(start),
+			Bytes:      -1,
+			RemoteAddr: req.RemoteIP().String(),
+			UserAgent:  string(req.UserAgent()),
+		}
+		if user, ok := req.User(); ok && user != nil {
+			entry.UserID = user.GetID()
+		}
+		if _, stream := resp.(StreamResponse); !stream && !isTimedOut(resp) {
+			// buffer the body once, json responses would marshal again when written
+			if body, err := resp.GetBytes(); err == nil {
+				entry.Bytes = len(body)
+				resp = NewResponse(body, resp.GetError(), resp.GetCode(), resp.GetHeaders()...)
+			}
+		}
+
+		logger := cfg.Logger
+		if logger == nil {
+			logger = req.Logger()
+		}
+		logger.Info(cfg.Format(entry), accessLogFields(entry, cfg.Fields))
+		return resp
+	}
+}
+
+func accessLogFields(e AccessLogEntry, names []string) Fields {
+	all := Fields{
+		AccessLogMethod:     e.Method,
+		AccessLogPath:       e.Path,
+		AccessLogRoute:      e.Route,
+		AccessLogStatus:     e.Status,
+		AccessLogDuration:   e.Duration.Seconds(),
+		AccessLogBytes:      e.Bytes,
+		AccessLogRemoteAddr: e.RemoteAddr,
+		AccessLogUserID:     e.UserID,
+		AccessLogUserAgent:  e.UserAgent,
+	}
+	fields := make(Fields, len(names))
+	for _, name := range names {
+		if v, ok := all[name]; ok {
+			fields[name] = v
+		}
+	}
+	return fields
+}
@@ -0,0 +1,187 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+type HttpClientConfig struct {
+	BaseURL string
+	// Timeout per attempt, bounded by the context deadline
+	Timeout time.Duration
+	// Retries additional attempts for idempotent methods on transport errors and 502/503/504
+	Retries      int
+	RetryBackoff time.Duration
+	Headers      Headers
+}
+
+type HttpClient interface {
+	Do(ctx context.Context, method, url string, body []byte, headers ...Header) ([]byte, error)
+	GetJSON(ctx context.Context, url string, dest interface{}) error
+	PostJSON(ctx context.Context, url string, payload interface{}, dest interface{}) error
+	PutJSON(ctx context.Context, url string, payload interface{}, dest interface{}) error
+	DeleteJSON(ctx context.Context, url string, dest interface{}) error
+}
+
+type httpClient struct {
+	client *fasthttp.Client
+	config HttpClientConfig
+}
+
+func NewHttpClient(config HttpClientConfig) HttpClient {
+	if config.Timeout <= 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.RetryBackoff <= 0 {
+		config.RetryBackoff = 100 * time.Millisecond
+	}
+	return &httpClient{client: &fasthttp.Client{}, config: config}
+}
+
+func (c *httpClient) Do(ctx context.Context, method, url string, body []byte, headers ...Header) ([]byte, error) {
+	attempts := 1
+	if isIdempotentMethod(method) {
+		attempts += c.config.Retries
+	}
+	backoff := c.config.RetryBackoff
+	var err error
+	for attempt := 1; ; attempt++ {
+		var code int
+		var resp []byte
+		code, resp, err = c.do(ctx, method, url, body, headers)
+		if err == nil {
+			return resp, upstreamErr(ctx, method, url, code, resp)
+		}
+		if attempt >= attempts {
+			break
+		}
+		LoggerFromContext(ctx).Warn(fmt.Sprintf("upstream %s %s failed: %s, retry %d/%d", method, url, err, attempt, attempts-1))
+		select {
+		case <-ctx.Done():
+			return nil, BadGatewayErr(ctx.Err().Error())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+	return nil, BadGatewayErr(err.Error())
+}
+
+// do performs a single attempt, err is set for transport errors and retryable statuses
+func (c *httpClient) do(ctx context.Context, method, url string, body []byte, headers Headers) (int, []byte, error) {
+	req := fasthttp.AcquireRequest()
+	resp := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(resp)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI(c.config.BaseURL + url)
+	if body != nil {
+		req.Header.SetContentType(ApplicationJsonHeaderVal)
+		req.SetBody(body)
+	}
+	if id, ok := RequestIDValue.Get(ctx); ok {
+		req.Header.Set(RequestIDHeaderName, id)
+	}
+	c.config.Headers.Each(func(name, val string) {
+		req.Header.Set(name, val)
+	})
+	headers.Each(func(name, val string) {
+		req.Header.Set(name, val)
+	})
+
+	timeout := c.config.Timeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	if err := c.client.DoTimeout(req, resp, timeout); err != nil {
+		return 0, nil, err
+	}
+	code := resp.StatusCode()
+	respBody := append([]byte(nil), resp.Body()...)
+	if isRetryableUpstream(code) {
+		return code, respBody, fmt.Errorf("upstream responded %d", code)
+	}
+	return code, respBody, nil
+}
+
+func (c *httpClient) GetJSON(ctx context.Context, url string, dest interface{}) error {
+	return c.doJSON(ctx, Get, url, nil, dest)
+}
+
+func (c *httpClient) PostJSON(ctx context.Context, url string, payload interface{}, dest interface{}) error {
+	return c.doJSON(ctx, Post, url, payload, dest)
+}
+
+func (c *httpClient) PutJSON(ctx context.Context, url string, payload interface{}, dest interface{}) error {
+	return c.doJSON(ctx, Put, url, payload, dest)
+}
+
+func (c *httpClient) DeleteJSON(ctx context.Context, url string, dest interface{}) error {
+	return c.doJSON(ctx, Delete, url, nil, dest)
+}
+
+func (c *httpClient) doJSON(ctx context.Context, method, url string, payload interface{}, dest interface{}) error {
+	var body []byte
+	if payload != nil {
+		marshaled, err := marshalJSON(payload)
+		if err != nil {
+			return Wrap(err)
+		}
+		body = marshaled
+	}
+	resp, err := c.Do(ctx, method, url, body, Header{Name: AcceptHeaderName, Value: ApplicationJsonHeaderVal})
+	if err != nil {
+		return err
+	}
+	if dest == nil || len(resp) == 0 {
+		return nil
+	}
+	if err := unmarshalJSON(resp, dest); err != nil {
+		return BadGatewayErr("Invalid upstream response")
+	}
+	return nil
+}
+
+func isIdempotentMethod(method string) bool {
+	return StringsContains([]string{Get, Head, Put, Delete, Options, Trace}, method)
+}
+
+func isRetryableUpstream(code int) bool {
+	return code == 0 ||
+		code == fasthttp.StatusBadGateway ||
+		code == fasthttp.StatusServiceUnavailable ||
+		code == fasthttp.StatusGatewayTimeout
+}
+
+// upstreamErr maps upstream status codes to the package errors. The upstream body is only logged,
+// a 401 concerns our own upstream credentials and is reported as a bad gateway.
+func upstreamErr(ctx context.Context, method, url string, code int, body []byte) error {
+	if code < 400 {
+		return nil
+	}
+	LoggerFromContext(ctx).Warn(fmt.Sprintf("upstream %s %s responded %d: %s", method, url, code, Substr(string(body), 0, 256)))
+	message := fmt.Sprintf("upstream responded %d", code)
+	switch code {
+	case fasthttp.StatusBadRequest:
+		return BadRequestErr(message)
+	case fasthttp.StatusUnauthorized:
+		return BadGatewayErr(message)
+	case fasthttp.StatusForbidden:
+		return AccessDeniedErr(message)
+	case fasthttp.StatusNotFound:
+		return ObjectNotFoundErr(message)
+	case fasthttp.StatusConflict:
+		return ConflictErr(message)
+	case fasthttp.StatusPreconditionFailed:
+		return PreconditionFailedErr(message)
+	case fasthttp.StatusUnprocessableEntity:
+		return NewUnprocessableEntityErr(message)
+	}
+	if code < 500 {
+		return BadRequestErr(message)
+	}
+	return BadGatewayErr(message)
+}
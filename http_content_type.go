@@ -0,0 +1,43 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AttrContentTypes per route list ([]string) of accepted request content types, overrides the middleware defaults
+const AttrContentTypes = "content_types"
+
+// NewContentTypeMiddleware rejects unsafe method requests carrying a body with a Content-Type
+// outside of the allowed list (application/json by default) with UnsupportedMediaTypeErr.
+// Parameters such as charset are ignored when matching.
+func NewContentTypeMiddleware(allowed ...string) Middleware {
+	if len(allowed) == 0 {
+		allowed = []string{ApplicationJsonHeaderVal}
+	}
+	return func(req Request, next Handler) Response {
+		if !isUnsafeMethod(string(req.Method())) || len(req.PostBody()) == 0 {
+			return next(req)
+		}
+		types := allowed
+		if attr, ok := req.Attr(AttrContentTypes); ok {
+			if routeTypes, ok := attr.([]string); ok {
+				types = routeTypes
+			}
+		}
+		contentType := mediaType(string(req.Request.Header.ContentType()))
+		for _, t := range types {
+			if strings.EqualFold(contentType, mediaType(t)) {
+				return next(req)
+			}
+		}
+		return NewErrorJSONResponse(UnsupportedMediaTypeErr(fmt.Sprintf("Unsupported media type %s, expected one of %s", contentType, strings.Join(types, ", "))))
+	}
+}
+
+func mediaType(contentType string) string {
+	if i := strings.IndexByte(contentType, ';'); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
@@ -0,0 +1,285 @@
+package core
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/slmder/qbuilder"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// AttrSoftDelete per route override (bool) of CRUDConfig.SoftDelete for the delete handler
+	AttrSoftDelete = "soft_delete"
+
+	CRUDIDParam         = "id"
+	DefaultCRUDPageSize = 20
+	DefaultCRUDMaxLimit = 100
+)
+
+type CRUDConfig struct {
+	// SoftDelete sets deleted_at instead of deleting rows and hides soft deleted rows from list and get
+	SoftDelete bool
+	// Filters query parameters allowed as equality conditions of the list handler, e.g. ?status=active
+	Filters []string
+	// Pagination defaults of the list handler, DefaultCRUDPageSize and DefaultCRUDMaxLimit when zero
+	Pagination Pagination
+	MaxLimit   uint32
+}
+
+// CRUD handlers of a table, entities are structs with `db` and `json` tags identified by the id column
+type CRUD struct {
+	List   Handler
+	Get    Handler
+	Create Handler
+	Update Handler
+	Patch  Handler
+	Delete Handler
+}
+
+// Routes GET path (list), POST path (create), GET/PUT/PATCH/DELETE path/{id}
+func (c CRUD) Routes(path string) Route {
+	item := fmt.Sprintf("/{%s}", CRUDIDParam)
+	return Route{Path: path, Inner: RouteList{
+		{Path: "", Method: Get, Handler: c.List},
+		{Path: "", Method: Post, Handler: c.Create},
+		{Path: item, Method: Get, Handler: c.Get},
+		{Path: item, Method: Put, Handler: c.Update},
+		{Path: item, Method: Patch, Handler: c.Patch},
+		{Path: item, Method: Delete, Handler: c.Delete},
+	}}
+}
+
+type crud struct {
+	dal        Dal
+	table      string
+	entityType reflect.Type
+	config     CRUDConfig
+}
+
+// CRUDHandlers generic list (paginated, filtered), get, create, update and delete handlers of the table,
+// entityType is the struct (not pointer) type of the rows
+func CRUDHandlers(dal Dal, table string, entityType reflect.Type, config ...CRUDConfig) CRUD {
+	var cfg CRUDConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if entityType.Kind() == reflect.Ptr {
+		entityType = entityType.Elem()
+	}
+	if entityType.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("CRUD entity type must be a struct, %s given", entityType))
+	}
+	if cfg.Pagination.Limit == 0 {
+		cfg.Pagination.Limit = DefaultCRUDPageSize
+	}
+	if cfg.MaxLimit == 0 {
+		cfg.MaxLimit = DefaultCRUDMaxLimit
+	}
+	c := &crud{dal: dal, table: table, entityType: entityType, config: cfg}
+	return CRUD{List: c.list, Get: c.get, Create: c.create, Update: c.update, Patch: c.patch, Delete: c.delete}
+}
+
+func (c *crud) conditions(cond qbuilder.Conditions) qbuilder.Conditions {
+	if c.config.SoftDelete {
+		cond[ColumnDeletedAt] = nil
+	}
+	return cond
+}
+
+func (c *crud) list(req Request) Response {
+	cond := qbuilder.Conditions{}
+	for _, filter := range c.config.Filters {
+		if req.QueryArgs().Has(filter) {
+			cond[filter] = string(req.QueryArgs().Peek(filter))
+		}
+	}
+	pag, err := req.Pagination(c.config.Pagination, c.config.MaxLimit)
+	if err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	items := reflect.New(reflect.SliceOf(c.entityType))
+	items.Elem().Set(reflect.MakeSlice(items.Elem().Type(), 0, 0))
+	total, err := c.dal.FindByPaged(req, c.table, items.Interface(), c.conditions(cond), pag)
+	if err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	return NewPaginatedJsonResponse(items.Elem().Interface(), total, pag)
+}
+
+func (c *crud) get(req Request) Response {
+	entity := reflect.New(c.entityType).Interface()
+	if err := c.find(req, entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	return NewJsonResponse(entity, fasthttp.StatusOK, nil)
+}
+
+func (c *crud) find(req Request, entity interface{}) error {
+	return c.dal.FindOneBy(req, c.table, entity, c.conditions(qbuilder.Conditions{CRUDIDParam: c.id(req)}))
+}
+
+func (c *crud) create(req Request) Response {
+	entity := reflect.New(c.entityType).Interface()
+	if err := req.ParseForm(entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	// a zero id is left to the column default (serial, gen_random_uuid()), created_at and deleted_at
+	// are never taken from the client
+	exclude := []string{ColumnCreatedAt, ColumnDeletedAt}
+	if field, ok := findColumnField(reflect.ValueOf(entity).Elem(), CRUDIDParam); ok && field.IsZero() {
+		exclude = append(exclude, CRUDIDParam)
+	}
+	query := fmt.Sprintf("%s RETURNING %s", qbuilder.Insert(c.table).RowE(entity, exclude...).ToSQL(), qbuilder.SelectList(entity))
+	if err := c.dal.DoInsertReturning(req, query, entity, entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	return NewJsonResponse(entity, fasthttp.StatusCreated, nil)
+}
+
+func (c *crud) update(req Request) Response {
+	entity := reflect.New(c.entityType).Interface()
+	if err := req.ParseForm(entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	if err := setEntityID(entity, c.id(req)); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	where := fmt.Sprintf("%s = :%s", CRUDIDParam, CRUDIDParam)
+	if c.config.SoftDelete {
+		where = fmt.Sprintf("%s AND %s IS NULL", where, ColumnDeletedAt)
+	}
+	query := qbuilder.Update(c.table).SetMapE(entity, CRUDIDParam, ColumnCreatedAt, ColumnDeletedAt).Where(where).ToSQL()
+	if err := c.dal.DoUpdateChecked(req, query, entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	// reload, columns maintained by the database are not part of the payload
+	if err := c.find(req, entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	return NewJsonResponse(entity, fasthttp.StatusOK, nil)
+}
+
+// patch updates the columns of the fields present in the payload, keys are the json names of the entity fields
+func (c *crud) patch(req Request) Response {
+	var payload map[string]interface{}
+	if err := req.ParseForm(&payload); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	columns := jsonColumns(c.entityType)
+	allowed := make([]string, 0, len(columns))
+	for _, column := range columns {
+		allowed = append(allowed, column)
+	}
+	changes := make(map[string]interface{}, len(payload))
+	for name, value := range payload {
+		if column, ok := columns[name]; ok {
+			changes[column] = value
+		}
+	}
+	// soft deleted rows are not found, DoPatch only matches the id
+	entity := reflect.New(c.entityType).Interface()
+	if err := c.find(req, entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	if err := c.dal.DoPatch(req, c.table, c.id(req), changes, allowed); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	if err := c.find(req, entity); err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	return NewJsonResponse(entity, fasthttp.StatusOK, nil)
+}
+
+// jsonColumns maps json field names to the db columns of the patchable fields
+func jsonColumns(t reflect.Type) map[string]string {
+	columns := make(map[string]string)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			for name, column := range jsonColumns(field.Type) {
+				columns[name] = column
+			}
+			continue
+		}
+		column := field.Tag.Get("db")
+		if column == "" || column == "-" || column == CRUDIDParam || column == ColumnCreatedAt || column == ColumnDeletedAt {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" || field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns[name] = column
+	}
+	return columns
+}
+
+func (c *crud) delete(req Request) Response {
+	soft := c.config.SoftDelete
+	if attr, ok := req.Attr(AttrSoftDelete); ok {
+		if v, ok := attr.(bool); ok {
+			soft = v
+		}
+	}
+	key := qbuilder.Conditions{CRUDIDParam: c.id(req)}
+	var affected int64
+	var err error
+	if soft {
+		// only rows not deleted yet, deleting twice is not found
+		affected, err = c.dal.SoftDeleteWhere(req, c.table, key)
+	} else {
+		affected, err = c.dal.Delete(req, c.table, key)
+	}
+	if err == nil && affected == 0 {
+		err = ObjectNotFoundErr()
+	}
+	if err != nil {
+		return NewErrorJSONResponse(err)
+	}
+	return NewResponse(nil, nil, fasthttp.StatusNoContent)
+}
+
+func (c *crud) id(req Request) string {
+	id, _ := req.UserValue(CRUDIDParam).(string)
+	return id
+}
+
+// setEntityID assigns the path id to the field tagged `db:"id"`
+func setEntityID(entity interface{}, id string) error {
+	field, ok := findColumnField(reflect.ValueOf(entity).Elem(), CRUDIDParam)
+	if !ok {
+		return Wrap(fmt.Errorf("no field tagged `db:\"%s\"` in %T", CRUDIDParam, entity))
+	}
+	if scanner, ok := field.Addr().Interface().(sql.Scanner); ok {
+		if err := scanner.Scan(id); err != nil {
+			return BadRequestErr(fmt.Sprintf("Invalid id %s", id))
+		}
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(id)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return BadRequestErr(fmt.Sprintf("Invalid id %s", id))
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			return BadRequestErr(fmt.Sprintf("Invalid id %s", id))
+		}
+		field.SetUint(n)
+	default:
+		return Wrap(fmt.Errorf("unsupported id field type %s", field.Type()))
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	DefaultCSRFCookieName = "punqy_csrf"
+	DefaultCSRFHeaderName = "X-CSRF-Token"
+	DefaultCSRFFieldName  = "_csrf_token"
+	RequestValueCSRFToken = "csrf-token"
+
+	csrfTokenBytes = 32
+)
+
+type CSRFConfig struct {
+	CookieName string
+	HeaderName string
+	FieldName  string
+	Path       string
+	Domain     string
+	Secure     bool
+	SameSite   fasthttp.CookieSameSite
+}
+
+// NewCSRFMiddleware implements the double submit cookie pattern: a random token is issued as a cookie
+// and unsafe requests must echo it in the header or the form field.
+func NewCSRFMiddleware(config ...CSRFConfig) Middleware {
+	var cfg CSRFConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = DefaultCSRFCookieName
+	}
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = DefaultCSRFHeaderName
+	}
+	if cfg.FieldName == "" {
+		cfg.FieldName = DefaultCSRFFieldName
+	}
+	if cfg.Path == "" {
+		cfg.Path = "/"
+	}
+	if cfg.SameSite == fasthttp.CookieSameSiteDisabled {
+		cfg.SameSite = fasthttp.CookieSameSiteLaxMode
+	}
+	return func(req Request, next Handler) Response {
+		token := string(req.Request.Header.Cookie(cfg.CookieName))
+		if token == "" {
+			if isUnsafeMethod(string(req.Method())) {
+				return NewErrorJSONResponse(AccessDeniedErr("Missing CSRF token"))
+			}
+			generated, err := GenerateToken(csrfTokenBytes)
+			if err != nil {
+				return NewErrorJSONResponse(Wrap(err))
+			}
+			token = generated
+			setCSRFCookie(req, cfg, token)
+		}
+		CSRFTokenValue.Set(req, token)
+		if !isUnsafeMethod(string(req.Method())) {
+			return next(req)
+		}
+		submitted := csrfSubmittedToken(req, cfg)
+		if subtle.ConstantTimeCompare([]byte(submitted), []byte(token)) != 1 {
+			return NewErrorJSONResponse(AccessDeniedErr("Invalid CSRF token"))
+		}
+		return next(req)
+	}
+}
+
+// CSRFToken returns the token issued by the CSRF middleware, to be embedded into forms
+func (r Request) CSRFToken() string {
+	return CSRFTokenValue.GetOrZero(r)
+}
+
+// CSRFField renders a hidden input carrying the token under DefaultCSRFFieldName,
+// use CSRFConfig.Field when the middleware is configured with another FieldName
+func CSRFField(token string) template.HTML {
+	return CSRFConfig{}.Field(token)
+}
+
+// Field renders a hidden input carrying the token under the configured FieldName, the templating engine
+// registers it as csrf_field, see TemplatingConfig.CSRFFieldName:
+//
+//	{{ csrf_field .Request }}
+func (c CSRFConfig) Field(token string) template.HTML {
+	name := c.FieldName
+	if name == "" {
+		name = DefaultCSRFFieldName
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`, template.HTMLEscapeString(name), template.HTMLEscapeString(token)))
+}
+
+func isUnsafeMethod(method string) bool {
+	return StringsContains([]string{Post, Put, Patch, Delete}, method)
+}
+
+func csrfSubmittedToken(req Request, cfg CSRFConfig) string {
+	if header := req.Request.Header.Peek(cfg.HeaderName); len(header) > 0 {
+		return string(header)
+	}
+	if field := req.PostArgs().Peek(cfg.FieldName); len(field) > 0 {
+		return string(field)
+	}
+	if form, err := req.MultipartForm(); err == nil {
+		if values := form.Value[cfg.FieldName]; len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+func setCSRFCookie(req Request, cfg CSRFConfig, token string) {
+	cookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(cookie)
+	cookie.SetKey(cfg.CookieName)
+	cookie.SetValue(token)
+	cookie.SetPath(cfg.Path)
+	cookie.SetDomain(cfg.Domain)
+	cookie.SetSecure(cfg.Secure)
+	cookie.SetSameSite(cfg.SameSite)
+	// readable by scripts so SPA clients can echo it in the header
+	cookie.SetHTTPOnly(false)
+	req.Response.Header.SetCookie(cookie)
+}
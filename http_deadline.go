@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RequestTimeoutHeaderName = "X-Request-Timeout"
+	GRPCTimeoutHeaderName    = "grpc-timeout"
+)
+
+type DeadlineConfig struct {
+	// Headers checked in order, X-Request-Timeout and grpc-timeout by default
+	Headers []string
+	// Default deadline of requests without the header, zero leaves them unbounded, Max does not apply to it
+	Default time.Duration
+	// Max caps the budget a client may ask for, "0" (unbounded) included, zero disables the cap
+	Max time.Duration
+}
+
+// NewDeadlineMiddleware applies the timeout budget sent by the caller as the request context deadline,
+// so queries and outgoing calls using the request inherit it, exceeding it is answered with GatewayTimeoutErr
+// like NewTimeoutMiddleware. X-Request-Timeout is a Go duration ("1.5s") or milliseconds ("1500"),
+// grpc-timeout follows the gRPC wire format ("1500m"). Unparsable values are ignored. A zero budget is
+// capped at Max, without Max it is ignored so clients cannot lift the Default deadline.
+func NewDeadlineMiddleware(config ...DeadlineConfig) Middleware {
+	var cfg DeadlineConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if len(cfg.Headers) == 0 {
+		cfg.Headers = []string{RequestTimeoutHeaderName, GRPCTimeoutHeaderName}
+	}
+	return func(req Request, next Handler) Response {
+		d, requested := cfg.Default, false
+		for _, name := range cfg.Headers {
+			value := string(req.Request.Header.Peek(name))
+			if value == "" {
+				continue
+			}
+			parsed, err := parseTimeoutHeader(name, value)
+			if err != nil {
+				req.Logger().Debug("deadline header ignored", Fields{"header": name, "error": err.Error()})
+				continue
+			}
+			d, requested = parsed, true
+			break
+		}
+		if requested && cfg.Max > 0 && (d <= 0 || d > cfg.Max) {
+			d = cfg.Max
+		}
+		if requested && d <= 0 {
+			d = cfg.Default
+		}
+		if d <= 0 {
+			return next(req)
+		}
+		return runWithTimeout(req, d, next)
+	}
+}
+
+func parseTimeoutHeader(name string, value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	if strings.EqualFold(name, GRPCTimeoutHeaderName) {
+		return parseGRPCTimeout(value)
+	}
+	if ms, err := strconv.ParseUint(value, 10, 63); err == nil {
+		return time.Duration(ms) * time.Millisecond, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err == nil && d <= 0 {
+		return 0, fmt.Errorf("non positive timeout '%s'", value)
+	}
+	return d, err
+}
+
+var grpcTimeoutUnits = map[byte]time.Duration{
+	'H': time.Hour,
+	'M': time.Minute,
+	'S': time.Second,
+	'm': time.Millisecond,
+	'u': time.Microsecond,
+	'n': time.Nanosecond,
+}
+
+// parseGRPCTimeout parses up to 8 digits followed by the unit, e.g. "100m"
+func parseGRPCTimeout(value string) (time.Duration, error) {
+	if len(value) < 2 || len(value) > 9 {
+		return 0, fmt.Errorf("invalid grpc timeout '%s'", value)
+	}
+	unit, ok := grpcTimeoutUnits[value[len(value)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid grpc timeout unit '%s'", value)
+	}
+	n, err := strconv.ParseUint(value[:len(value)-1], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid grpc timeout '%s'", value)
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,71 @@
+package core
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	ContentEncodingHeaderName = "Content-Encoding"
+
+	// DefaultMaxDecompressedBodySize limit of the decompressed request body, 10 MiB
+	DefaultMaxDecompressedBodySize = 10 << 20
+)
+
+// NewDecompressMiddleware transparently decompresses gzip and deflate encoded request bodies,
+// so ParseForm and ParseMultipart read the plain body. Bodies inflating above maxSize
+// (DefaultMaxDecompressedBodySize when omitted) are rejected with 413 to prevent zip bombs,
+// other encodings with 415.
+func NewDecompressMiddleware(maxSize ...int) Middleware {
+	limit := DefaultMaxDecompressedBodySize
+	if len(maxSize) > 0 && maxSize[0] > 0 {
+		limit = maxSize[0]
+	}
+	return func(req Request, next Handler) Response {
+		encoding := strings.ToLower(strings.TrimSpace(string(req.Request.Header.Peek(ContentEncodingHeaderName))))
+		if encoding == "" || encoding == "identity" || len(req.PostBody()) == 0 {
+			return next(req)
+		}
+		body, err := decompressBody(encoding, req.PostBody(), limit)
+		if err != nil {
+			return NewErrorJSONResponse(err)
+		}
+		req.Request.Header.Del(ContentEncodingHeaderName)
+		req.Request.SetBody(body)
+		return next(req)
+	}
+}
+
+func decompressBody(encoding string, compressed []byte, limit int) ([]byte, error) {
+	var reader io.ReadCloser
+	var err error
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err = gzip.NewReader(bytes.NewReader(compressed))
+	case "deflate":
+		// deflate is zlib wrapped per RFC 9110, some clients send raw deflate streams
+		reader, err = zlib.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			reader, err = flate.NewReader(bytes.NewReader(compressed)), nil
+		}
+	default:
+		return nil, UnsupportedMediaTypeErr(fmt.Sprintf("Unsupported content encoding %s", encoding))
+	}
+	if err != nil {
+		return nil, BadRequestErr("Invalid compressed body")
+	}
+	defer reader.Close()
+	body, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if err != nil {
+		return nil, BadRequestErr("Invalid compressed body")
+	}
+	if len(body) > limit {
+		return nil, RequestEntityTooLargeErr()
+	}
+	return body, nil
+}
@@ -0,0 +1,181 @@
+package core
+
+import (
+	"fmt"
+	"io/fs"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/valyala/fasthttp"
+)
+
+const ErrorTemplateName = "error.html"
+
+// ErrorRenderer builds the response for an error raised while handling req
+type ErrorRenderer func(req Request, err error) Response
+
+// NewErrorRenderer negotiates the error format with the Accept header, see NewErrorResponse
+func NewErrorRenderer(engine ...TemplatingEngine) ErrorRenderer {
+	return func(req Request, err error) Response {
+		return NewErrorResponse(req, err, engine...)
+	}
+}
+
+// NewErrorResponse renders an HTML error page when the client prefers text/html, JSON otherwise.
+// Messages are translated to the request locale with the package Translator, see SetTranslator.
+// With an engine the page goes through NewTemplatedErrorResponse.
+func NewErrorResponse(req Request, e error, engine ...TemplatingEngine) Response {
+	if e == nil {
+		return NewErrorJSONResponse(e)
+	}
+	data, code, err := translatedErrorPayload(req.Locale(), e)
+	if !PrefersHTML(req) {
+		return NewJsonResponse(data, code, err)
+	}
+	if message, ok := data.(string); ok {
+		err = translatedError{error: err, message: message}
+	}
+	if len(engine) > 0 && engine[0] != nil {
+		return NewTemplatedErrorResponse(engine[0], err, code)
+	}
+	return NewErrorHtmlResponse(err, code)
+}
+
+// errorJSONResponse is returned by NewErrorJSONResponse, the source error is kept to translate the message
+// once the request locale is known, see localize
+type errorJSONResponse struct {
+	jsonResponse
+	source error
+}
+
+// localize translates the message of a NewErrorJSONResponse to the preferred Accept-Language locale,
+// any other response is returned as is
+func localize(res Response, acceptLanguage string) Response {
+	er, ok := res.(errorJSONResponse)
+	if !ok {
+		return res
+	}
+	er.data, _, _ = translatedErrorPayload(parseAcceptLanguage(acceptLanguage), er.source)
+	return er.jsonResponse
+}
+
+// translatedErrorPayload is errorPayload with the message looked up by the underlying core error message,
+// e.g. "Not found" rather than "Error: Not found", the untranslated payload is kept when there is no translation
+func translatedErrorPayload(locale string, e error) (interface{}, int, error) {
+	data, code, err := errorPayload(e)
+	if message, ok := data.(string); ok {
+		if message == e.Error() {
+			message = errorMessage(e)
+		}
+		if translated := GetTranslator().Translate(locale, message); translated != message {
+			data = translated
+		}
+	}
+	return data, code, err
+}
+
+// errorMessage the message of the core error in the chain without the "Error" prefix, errors rewrapped
+// with Wrap are unwrapped down to the original one
+func errorMessage(e error) string {
+	var er erro
+	if !errors.As(e, &er) {
+		return e.Error()
+	}
+	for er.Err != nil && er.Err.Error() == er.Message {
+		var inner erro
+		if !errors.As(er.Err, &inner) {
+			break
+		}
+		er = inner
+	}
+	return er.Message
+}
+
+// translatedError keeps the original error for errors.Is/As while rendering the translated message
+type translatedError struct {
+	error
+	message string
+}
+
+func (e translatedError) Error() string {
+	return e.message
+}
+
+func (e translatedError) Unwrap() error {
+	return e.error
+}
+
+// NewTemplatedErrorResponse renders <code>.html, then ErrorTemplateName, with code, status, message and error vars.
+// When neither template exists the plain NewErrorHtmlResponse is returned.
+func NewTemplatedErrorResponse(engine TemplatingEngine, err error, code int) Response {
+	vars := Vars{
+		"code":    code,
+		"status":  fasthttp.StatusMessage(code),
+		"message": err.Error(),
+		"error":   err,
+	}
+	for _, name := range []string{fmt.Sprintf("%d.html", code), ErrorTemplateName} {
+		buf, renderErr := engine.Render(name, vars)
+		if renderErr == nil {
+			return NewResponse(buf.Bytes(), err, code, Header{Name: ContentTypeHeaderName, Value: TextHtmlUTF8HeaderVal})
+		}
+		if !errors.Is(renderErr, fs.ErrNotExist) {
+			GetLogger().Error("error template render failed", Fields{"template": name, "error": renderErr.Error()})
+			break
+		}
+	}
+	return NewErrorHtmlResponse(err, code)
+}
+
+// PrefersHTML reports whether text/html is weighted above JSON in the Accept header, JSON wins ties and wildcards
+func PrefersHTML(req Request) bool {
+	return prefersHTML(string(req.Request.Header.Peek(AcceptHeaderName)))
+}
+
+func prefersHTML(accept string) bool {
+	var htmlQ, jsonQ float64
+	for _, media := range parseQualityValues(accept) {
+		switch media.value {
+		case ApplicationTextHtmlHeaderVal, "application/xhtml+xml", "text/*":
+			if media.q > htmlQ {
+				htmlQ = media.q
+			}
+		case ApplicationJsonHeaderVal, "application/*", "*/*":
+			if media.q > jsonQ {
+				jsonQ = media.q
+			}
+		}
+	}
+	return htmlQ > jsonQ
+}
+
+// qualityValue an entry of a q weighted header such as Accept or Accept-Language
+type qualityValue struct {
+	value string
+	q     float64
+}
+
+// parseQualityValues splits a q weighted header into lowercased values, q defaults to 1
+func parseQualityValues(header string) []qualityValue {
+	values := make([]qualityValue, 0)
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		value := strings.ToLower(strings.TrimSpace(params[0]))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+			if v, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64); err == nil {
+				q = v
+			}
+		}
+		values = append(values, qualityValue{value: value, q: q})
+	}
+	return values
+}
@@ -1,7 +1,11 @@
 package core
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
+
+	"github.com/valyala/fasthttp"
 )
 
 const (
@@ -33,24 +37,139 @@ type Firewall interface {
 	Config() FirewallConfig
 }
 
+type FirewallOptions struct {
+	Rbac RbacConfig
+	// DenyByDefault answers requests matching no area with AccessDeniedErr, by default they are passed through
+	DenyByDefault bool
+	// LongestMatch applies the area with the longest matching pattern, by default the first matching area
+	// in config order wins and areas shadowed by an earlier broader pattern are logged as a warning
+	LongestMatch bool
+}
+
 type firewall struct {
-	enabled    bool
-	config     FirewallConfig
-	dispatcher EventDispatcher
+	enabled       bool
+	config        FirewallConfig
+	rbac          RbacConfig
+	dispatcher    EventDispatcher
+	denyByDefault bool
+	longestMatch  bool
+	areas         []compiledArea
+}
+
+// compiledArea patterns compiled once by the constructor
+type compiledArea struct {
+	Area
+	pattern *regexp.Regexp
+	public  []*regexp.Regexp
+}
+
+func NewFirewall(enabled bool, firewallConfig FirewallConfig, dispatcher EventDispatcher, rbac ...RbacConfig) Firewall {
+	var opts FirewallOptions
+	if len(rbac) > 0 {
+		opts.Rbac = rbac[0]
+	}
+	return NewFirewallWithOptions(enabled, firewallConfig, dispatcher, opts)
+}
+
+// NewFirewallWithOptions panics on invalid area or public path patterns
+func NewFirewallWithOptions(enabled bool, firewallConfig FirewallConfig, dispatcher EventDispatcher, opts FirewallOptions) Firewall {
+	f := &firewall{
+		enabled:       enabled,
+		config:        firewallConfig,
+		dispatcher:    dispatcher,
+		rbac:          opts.Rbac,
+		denyByDefault: opts.DenyByDefault,
+		longestMatch:  opts.LongestMatch,
+	}
+	for _, area := range firewallConfig {
+		compiled := compiledArea{Area: area, pattern: compileFirewallPattern(area.Pattern)}
+		for _, public := range area.Public {
+			compiled.public = append(compiled.public, compileFirewallPattern(public.Pattern))
+		}
+		f.areas = append(f.areas, compiled)
+	}
+	if !f.longestMatch {
+		warnShadowedAreas(f.areas)
+	}
+	return f
+}
+
+func compileFirewallPattern(pattern string) *regexp.Regexp {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		panic(fmt.Sprintf("invalid firewall pattern '%s': %s", pattern, err))
+	}
+	return re
 }
 
-func NewFirewall(enabled bool, firewallConfig FirewallConfig, dispatcher EventDispatcher) Firewall {
-	return &firewall{
-		enabled:    enabled,
-		config:     firewallConfig,
-		dispatcher: dispatcher,
+// warnShadowedAreas an area is likely unreachable when an earlier pattern already matches its literal prefix,
+// e.g. "^/api" listed before "^/api/admin"
+func warnShadowedAreas(areas []compiledArea) {
+	for i, area := range areas {
+		prefix, _ := area.pattern.LiteralPrefix()
+		if prefix == "" {
+			prefix = strings.TrimPrefix(area.Pattern, "^")
+		}
+		for _, earlier := range areas[:i] {
+			if earlier.pattern.MatchString(prefix) {
+				GetLogger().Warn("firewall area is shadowed by an earlier area, first match wins", Fields{"area": area.Pattern, "shadowed_by": earlier.Pattern})
+				break
+			}
+		}
 	}
 }
 
+// match first matching area, or the one with the longest pattern in longest match mode
+func (f *firewall) match(path []byte) (compiledArea, bool) {
+	var matched compiledArea
+	found := false
+	for _, area := range f.areas {
+		if !area.pattern.Match(path) {
+			continue
+		}
+		if !f.longestMatch {
+			return area, true
+		}
+		if !found || len(area.Pattern) > len(matched.Pattern) {
+			matched, found = area, true
+		}
+	}
+	return matched, found
+}
+
 type Area struct {
 	Secure        bool
 	Pattern       string
 	Authenticator Authenticator
+	// Public paths of a secure area served without authentication
+	Public []PublicPath
+	// AuthenticatePreflight authenticates CORS preflight (OPTIONS) requests too,
+	// by default they are answered with 204 as browsers never send credentials with them
+	AuthenticatePreflight bool
+}
+
+// PublicPath pattern (regexp) within a secure area, limited to Methods when set
+type PublicPath struct {
+	Pattern string
+	Methods []string
+}
+
+func (a compiledArea) isPublic(req Request) bool {
+	method := string(req.Method())
+	for i, public := range a.Public {
+		if !a.public[i].Match(req.Path()) {
+			continue
+		}
+		if len(public.Methods) == 0 {
+			return true
+		}
+		for _, m := range public.Methods {
+			if strings.EqualFold(m, method) {
+				return true
+			}
+		}
+	}
+	return false
 }
 
 type Authenticator interface {
@@ -65,17 +184,17 @@ func (f *firewall) Config() FirewallConfig {
 }
 
 func (f *firewall) Handle(req Request, next Handler) Response {
-	for _, area := range f.config {
-		if !regexp.MustCompile(area.Pattern).Match(req.Path()) {
-			continue
-		}
-		if !area.Secure {
+	if area, ok := f.match(req.Path()); ok {
+		if !area.Secure || area.isPublic(req) {
 			return next(req)
 		}
+		if !area.AuthenticatePreflight && req.IsOptions() {
+			return NewResponse(nil, nil, fasthttp.StatusNoContent)
+		}
 		if area.Authenticator == nil {
 			panic("Secure area must have an Authenticator.")
 		}
-		if err := dispatchEventSilent(req, f.dispatcher, BeforeAuthenticateEvent{Area: area, Request: req}); err != nil {
+		if err := dispatchEventSilent(req, f.dispatcher, BeforeAuthenticateEvent{Area: area.Area, Request: req}); err != nil {
 			return NewErrorJSONResponse(InternalServerErr(err.Error()))
 		}
 		token, err := area.Authenticator.Authenticate(req)
@@ -85,18 +204,22 @@ func (f *firewall) Handle(req Request, next Handler) Response {
 		if token == nil {
 			return NewErrorJSONResponse(InvalidGrantErr())
 		}
-		if err := dispatchEventSilent(req, f.dispatcher, AfterAuthenticateEvent{Area: area, Request: req, Token: token}); err != nil {
+		if err := dispatchEventSilent(req, f.dispatcher, AfterAuthenticateEvent{Area: area.Area, Request: req, Token: token}); err != nil {
 			return NewErrorJSONResponse(InternalServerErr(err.Error()))
 		}
 		securityContext := SecurityContext{
-			Token: token,
+			Token:         token,
+			RoleHierarchy: f.rbac.RoleHierarchy,
 		}
-		req.SetUserValue(SecurityContextKey, securityContext)
-		if appContext, ok := req.UserValue(profileContextKey).(*Profile); ok {
+		req.setSecurityContext(securityContext)
+		if appContext, ok := ProfileValue.Get(req); ok {
 			appContext.SetSecurityContext(securityContext)
 		}
 
 		return next(req)
 	}
-	return NewErrorJSONResponse(AccessDeniedErr())
+	if f.denyByDefault {
+		return NewErrorJSONResponse(AccessDeniedErr())
+	}
+	return next(req)
 }
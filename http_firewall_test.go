@@ -0,0 +1,62 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/valyala/fasthttp"
+)
+
+func okHandler(req Request) Response {
+	return NewResponse(nil, nil, fasthttp.StatusOK)
+}
+
+func TestFirewallPreflight(t *testing.T) {
+	authenticator := &testAuthenticator{}
+	f := NewFirewall(true, FirewallConfig{{Pattern: "^/api", Secure: true, Authenticator: authenticator}}, nil)
+
+	resp := f.Handle(newTestRequest(Options, "/api/users"), okHandler)
+
+	if resp.GetCode() != fasthttp.StatusNoContent {
+		t.Errorf("expected 204 for the preflight, got %d", resp.GetCode())
+	}
+	if authenticator.calls != 0 {
+		t.Errorf("expected the authenticator not to be called, called %d times", authenticator.calls)
+	}
+}
+
+func TestFirewallAuthenticatePreflight(t *testing.T) {
+	authenticator := &testAuthenticator{}
+	f := NewFirewall(true, FirewallConfig{{Pattern: "^/api", Secure: true, Authenticator: authenticator, AuthenticatePreflight: true}}, nil)
+
+	resp := f.Handle(newTestRequest(Options, "/api/users"), okHandler)
+
+	if resp.GetCode() != fasthttp.StatusUnauthorized {
+		t.Errorf("expected 401 for the unauthenticated preflight, got %d", resp.GetCode())
+	}
+	if authenticator.calls != 1 {
+		t.Errorf("expected the authenticator to be called once, called %d times", authenticator.calls)
+	}
+}
+
+func TestFirewallPublicPathMethods(t *testing.T) {
+	authenticator := &testAuthenticator{}
+	f := NewFirewall(true, FirewallConfig{{
+		Pattern:       "^/api",
+		Secure:        true,
+		Authenticator: authenticator,
+		Public:        []PublicPath{{Pattern: "^/api/articles", Methods: []string{Get}}},
+	}}, nil)
+
+	if resp := f.Handle(newTestRequest(Get, "/api/articles"), okHandler); resp.GetCode() != fasthttp.StatusOK {
+		t.Errorf("expected public GET to pass, got %d", resp.GetCode())
+	}
+	if authenticator.calls != 0 {
+		t.Errorf("expected public GET not to authenticate, called %d times", authenticator.calls)
+	}
+	if resp := f.Handle(newTestRequest(Post, "/api/articles"), okHandler); resp.GetCode() != fasthttp.StatusUnauthorized {
+		t.Errorf("expected POST to require authentication, got %d", resp.GetCode())
+	}
+	if authenticator.calls != 1 {
+		t.Errorf("expected POST to authenticate, called %d times", authenticator.calls)
+	}
+}
@@ -0,0 +1,127 @@
+package core
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	DefaultFlashCookieName = "flash"
+	RequestValueFlashes    = "flashes"
+	DefaultFlashTTL        = 5 * time.Minute
+)
+
+type FlashMessage struct {
+	Category string `json:"c"`
+	Message  string `json:"m"`
+}
+
+type FlashConfig struct {
+	Name   string
+	Secret []byte
+	// TTL how long unread messages survive, DefaultFlashTTL by default
+	TTL      time.Duration
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite fasthttp.CookieSameSite
+}
+
+// flashBag unread messages of the cookie and the ones added while handling the request
+type flashBag struct {
+	incoming []FlashMessage
+	changed  bool
+	outgoing []FlashMessage
+}
+
+// NewFlashMiddleware keeps flash messages in a signed cookie, so they survive a redirect.
+// Messages stay in the cookie until they are read with Request.Flashes or the flashes template function.
+func NewFlashMiddleware(config FlashConfig) Middleware {
+	if len(config.Secret) == 0 {
+		panic("Flash middleware requires a secret.")
+	}
+	if config.Name == "" {
+		config.Name = DefaultFlashCookieName
+	}
+	if config.TTL <= 0 {
+		config.TTL = DefaultFlashTTL
+	}
+	if config.Path == "" {
+		config.Path = "/"
+	}
+	if config.SameSite == fasthttp.CookieSameSiteDisabled {
+		config.SameSite = fasthttp.CookieSameSiteLaxMode
+	}
+	signer := cookieSigner{secret: config.Secret}
+	return func(req Request, next Handler) Response {
+		bag := &flashBag{}
+		if value := req.Request.Header.Cookie(config.Name); len(value) > 0 {
+			if decoded, err := signer.verify(string(value)); err == nil {
+				if err := json.Unmarshal([]byte(decoded), &bag.incoming); err != nil {
+					bag.incoming = nil
+				}
+			}
+		}
+		req.SetUserValue(RequestValueFlashes, bag)
+		resp := next(req)
+
+		if isTimedOut(resp) || (!bag.changed && len(bag.outgoing) == 0) {
+			return resp
+		}
+		pending := append(bag.incoming, bag.outgoing...)
+		cookie := fasthttp.AcquireCookie()
+		defer fasthttp.ReleaseCookie(cookie)
+		cookie.SetKey(config.Name)
+		cookie.SetPath(config.Path)
+		cookie.SetDomain(config.Domain)
+		cookie.SetSecure(config.Secure)
+		cookie.SetHTTPOnly(true)
+		cookie.SetSameSite(config.SameSite)
+		if len(pending) == 0 {
+			cookie.SetExpire(fasthttp.CookieExpireDelete)
+		} else {
+			marshaled, err := json.Marshal(pending)
+			if err != nil {
+				req.Logger().Error(err.Error())
+				return resp
+			}
+			cookie.SetValue(signer.sign(string(marshaled), time.Now().Add(config.TTL)))
+		}
+		req.Response.Header.SetCookie(cookie)
+		return resp
+	}
+}
+
+// AddFlash queues a message for the next request, requires NewFlashMiddleware
+func (r Request) AddFlash(category, message string) {
+	bag, ok := r.UserValue(RequestValueFlashes).(*flashBag)
+	if !ok {
+		r.Logger().Warn("AddFlash called without the flash middleware")
+		return
+	}
+	bag.outgoing = append(bag.outgoing, FlashMessage{Category: category, Message: message})
+}
+
+// Flashes returns the messages added by the previous requests and clears them,
+// only the given categories are returned when any are passed
+func (r Request) Flashes(category ...string) []FlashMessage {
+	bag, ok := r.UserValue(RequestValueFlashes).(*flashBag)
+	if !ok {
+		return nil
+	}
+	var messages, unread []FlashMessage
+	for _, m := range bag.incoming {
+		if len(category) == 0 || StringsContains(category, m.Category) {
+			messages = append(messages, m)
+		} else {
+			unread = append(unread, m)
+		}
+	}
+	if len(messages) > 0 {
+		bag.incoming = unread
+		bag.changed = true
+	}
+	return messages
+}
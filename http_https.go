@@ -0,0 +1,97 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+const ForwardedProtoHeaderName = "X-Forwarded-Proto"
+
+type HTTPSRedirectConfig struct {
+	// TrustedProxies IPs or CIDRs (10.0.0.0/8) whose X-Forwarded-Proto is believed, the header is ignored otherwise
+	TrustedProxies []string
+	// Host (and port) redirects are sent to, the client Host header is never used. Without it insecure
+	// GET/HEAD requests are rejected like the others.
+	Host string
+	// RejectStatus of plain HTTP requests other than GET/HEAD, fasthttp.StatusForbidden or StatusBadRequest (default)
+	RejectStatus int
+}
+
+// NewHTTPSRedirectMiddleware redirects insecure GET/HEAD requests to the https:// URL and rejects the others,
+// a request is secure when served over TLS or forwarded by a trusted proxy with X-Forwarded-Proto: https
+// (the value appended by the last proxy, earlier ones are client controlled).
+// Panics on invalid TrustedProxies.
+func NewHTTPSRedirectMiddleware(config ...HTTPSRedirectConfig) Middleware {
+	var cfg HTTPSRedirectConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	proxies := parseTrustedProxies(cfg.TrustedProxies)
+	return func(req Request, next Handler) Response {
+		if req.IsTLS() || isForwardedHTTPS(req, proxies) {
+			return next(req)
+		}
+		switch string(req.Method()) {
+		case Get, Head:
+			if cfg.Host != "" {
+				return NewRedirectResponse(fmt.Sprintf("https://%s%s", cfg.Host, req.URI().RequestURI()))
+			}
+		}
+		if cfg.RejectStatus == fasthttp.StatusForbidden {
+			return NewErrorJSONResponse(AccessDeniedErr("HTTPS required"))
+		}
+		return NewErrorJSONResponse(BadRequestErr("HTTPS required"))
+	}
+}
+
+func isForwardedHTTPS(req Request, proxies []*net.IPNet) bool {
+	if !containsIP(proxies, req.RemoteIP()) {
+		return false
+	}
+	// proxies append to the list or add a header line, only the value of the last hop (the trusted proxy)
+	// is not client controlled
+	var last string
+	req.Request.Header.VisitAll(func(key, value []byte) {
+		if strings.EqualFold(string(key), ForwardedProtoHeaderName) {
+			values := strings.Split(string(value), ",")
+			last = values[len(values)-1]
+		}
+	})
+	return strings.EqualFold(strings.TrimSpace(last), "https")
+}
+
+func parseTrustedProxies(proxies []string) []*net.IPNet {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				panic(fmt.Sprintf("invalid trusted proxy '%s'", proxy))
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid trusted proxy '%s': %s", proxy, err))
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, ipNet := range nets {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
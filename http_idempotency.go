@@ -0,0 +1,196 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeaderName      = "Idempotency-Key"
+	IdempotencyReplayedHeaderName = "Idempotent-Replayed"
+	DefaultIdempotencyTTL         = 24 * time.Hour
+
+	// idempotencySweepInterval between full scans of the memory store for expired records
+	idempotencySweepInterval = time.Minute
+)
+
+// IdempotencyRecord a pending (Done false) or completed request stored under an idempotency key
+type IdempotencyRecord struct {
+	Fingerprint string
+	Done        bool
+	Code        int
+	Headers     Headers
+	Body        []byte
+}
+
+type IdempotencyStore interface {
+	// Begin stores the pending record unless the key is taken, in which case the existing record is returned
+	Begin(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error)
+	Complete(ctx context.Context, key string, record IdempotencyRecord, ttl time.Duration) error
+	// Release drops the record so the request can be retried
+	Release(ctx context.Context, key string) error
+}
+
+type IdempotencyConfig struct {
+	Store      IdempotencyStore
+	TTL        time.Duration
+	HeaderName string
+}
+
+// NewIdempotencyMiddleware replays the stored response of unsafe method requests repeating an Idempotency-Key
+// (per principal, method and path) within the TTL. The principal is the authenticated user, or the Authorization
+// credentials, so the middleware must run inside the firewall for clients never to get each other's responses. A different payload for the same key is answered with 422,
+// a still running one with 409. Server errors and streamed responses are not stored, so they can be retried.
+// The in-memory store is used unless another one is configured.
+func NewIdempotencyMiddleware(config ...IdempotencyConfig) Middleware {
+	var cfg IdempotencyConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Store == nil {
+		cfg.Store = NewMemoryIdempotencyStore()
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = DefaultIdempotencyTTL
+	}
+	if cfg.HeaderName == "" {
+		cfg.HeaderName = IdempotencyKeyHeaderName
+	}
+	return func(req Request, next Handler) Response {
+		header := string(req.Request.Header.Peek(cfg.HeaderName))
+		if header == "" || !isUnsafeMethod(string(req.Method())) {
+			return next(req)
+		}
+		key := fmt.Sprintf("%s %s %s %s", idempotencyPrincipal(req), req.Method(), req.Path(), header)
+		sum := sha256.Sum256(req.PostBody())
+		fingerprint := hex.EncodeToString(sum[:])
+
+		existing, err := cfg.Store.Begin(req, key, IdempotencyRecord{Fingerprint: fingerprint}, cfg.TTL)
+		if err != nil {
+			return NewErrorJSONResponse(Wrap(err))
+		}
+		if existing != nil {
+			if existing.Fingerprint != fingerprint {
+				return NewErrorJSONResponse(NewUnprocessableEntityErr("Idempotency key reused with a different payload"))
+			}
+			if !existing.Done {
+				return NewErrorJSONResponse(ConflictErr("A request with this idempotency key is in progress"))
+			}
+			headers := append(Headers{}, existing.Headers...)
+			headers = append(headers, Header{Name: IdempotencyReplayedHeaderName, Value: "true"})
+			return NewResponse(existing.Body, nil, existing.Code, headers...)
+		}
+
+		resp := idempotentNext(req, next, cfg.Store, key)
+		if _, stream := resp.(StreamResponse); stream || resp.GetCode() >= 500 {
+			if err := cfg.Store.Release(req, key); err != nil {
+				req.Logger().Error(err.Error())
+			}
+			return resp
+		}
+		body, err := resp.GetBytes()
+		if err != nil {
+			if err := cfg.Store.Release(req, key); err != nil {
+				req.Logger().Error(err.Error())
+			}
+			return resp
+		}
+		record := IdempotencyRecord{
+			Fingerprint: fingerprint,
+			Done:        true,
+			Code:        resp.GetCode(),
+			Headers:     resp.GetHeaders(),
+			Body:        body,
+		}
+		if err := cfg.Store.Complete(req, key, record, cfg.TTL); err != nil {
+			req.Logger().Error(err.Error())
+		}
+		return NewResponse(body, resp.GetError(), resp.GetCode(), resp.GetHeaders()...)
+	}
+}
+
+// idempotentNext releases the pending key when next panics so retries are not answered with 409 until the TTL,
+// the panic is passed on to the recovery
+func idempotentNext(req Request, next Handler, store IdempotencyStore, key string) Response {
+	defer func() {
+		if rec := recover(); rec != nil {
+			if err := store.Release(req, key); err != nil {
+				req.Logger().Error(err.Error())
+			}
+			panic(rec)
+		}
+	}()
+	return next(req)
+}
+
+// idempotencyPrincipal scopes the keys to the user, its credentials when there is no user (client tokens)
+func idempotencyPrincipal(req Request) string {
+	if user, ok := req.User(); ok {
+		return fmt.Sprintf("user:%s", user.GetID())
+	}
+	if credentials := req.Request.Header.Peek("Authorization"); len(credentials) > 0 {
+		sum := sha256.Sum256(credentials)
+		return fmt.Sprintf("credentials:%s", hex.EncodeToString(sum[:]))
+	}
+	return "anonymous"
+}
+
+type memoryIdempotencyEntry struct {
+	record    IdempotencyRecord
+	expiresAt time.Time
+}
+
+type memoryIdempotencyStore struct {
+	mu        sync.Mutex
+	records   map[string]memoryIdempotencyEntry
+	lastSweep time.Time
+}
+
+// NewMemoryIdempotencyStore process local store, use a shared one when running several instances
+func NewMemoryIdempotencyStore() IdempotencyStore {
+	return &memoryIdempotencyStore{records: make(map[string]memoryIdempotencyEntry)}
+}
+
+func (s *memoryIdempotencyStore) Begin(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) (*IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.evict(now)
+	if entry, ok := s.records[key]; ok && !now.After(entry.expiresAt) {
+		existing := entry.record
+		return &existing, nil
+	}
+	s.records[key] = memoryIdempotencyEntry{record: record, expiresAt: now.Add(ttl)}
+	return nil, nil
+}
+
+func (s *memoryIdempotencyStore) Complete(_ context.Context, key string, record IdempotencyRecord, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[key] = memoryIdempotencyEntry{record: record, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) Release(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// evict scans the records at most once per idempotencySweepInterval, Begin ignores expired ones in between
+func (s *memoryIdempotencyStore) evict(now time.Time) {
+	if now.Sub(s.lastSweep) < idempotencySweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.records {
+		if now.After(entry.expiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
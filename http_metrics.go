@@ -0,0 +1,93 @@
+package core
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/valyala/fasthttp"
+)
+
+const unmatchedRouteLabel = "unmatched"
+
+type MetricsConfig struct {
+	// Registerer defaults to prometheus.DefaultRegisterer
+	Registerer prometheus.Registerer
+	Namespace  string
+	// Buckets of the duration histogram in seconds, defaults to prometheus.DefBuckets
+	Buckets []float64
+}
+
+// NewMetricsMiddleware records RED metrics, http_requests_total and http_request_duration_seconds,
+// labeled by method, route pattern (not the raw uri, to bound the cardinality) and response code.
+func NewMetricsMiddleware(config ...MetricsConfig) Middleware {
+	var cfg MetricsConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.Registerer == nil {
+		cfg.Registerer = prometheus.DefaultRegisterer
+	}
+	if len(cfg.Buckets) == 0 {
+		cfg.Buckets = prometheus.DefBuckets
+	}
+	labels := []string{"method", "route", "code"}
+	requests := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: cfg.Namespace,
+		Name:      "http_requests_total",
+		Help:      "Number of handled HTTP requests.",
+	}, labels)
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: cfg.Namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of handled HTTP requests.",
+		Buckets:   cfg.Buckets,
+	}, labels)
+	cfg.Registerer.MustRegister(requests, duration)
+
+	return func(req Request, next Handler) Response {
+		start := time.Now()
+		resp := next(req)
+		route := req.Route().Pattern()
+		if route == "" {
+			route = unmatchedRouteLabel
+		}
+		code := resp.GetCode()
+		if code == 0 {
+			code = fasthttp.StatusInternalServerError
+		}
+		values := []string{string(req.Method()), route, strconv.Itoa(code)}
+		requests.WithLabelValues(values...).Inc()
+		duration.WithLabelValues(values...).Observe(time.Since(start).Seconds())
+		return resp
+	}
+}
+
+// NewMetricsRoute exposes the gathered metrics in the prometheus text format, prometheus.DefaultGatherer by default
+func NewMetricsRoute(path string, gatherer ...prometheus.Gatherer) Route {
+	g := prometheus.Gatherer(prometheus.DefaultGatherer)
+	if len(gatherer) > 0 && gatherer[0] != nil {
+		g = gatherer[0]
+	}
+	return Route{
+		Path:   path,
+		Method: Get,
+		Handler: func(req Request) Response {
+			families, err := g.Gather()
+			if err != nil {
+				return NewErrorJSONResponse(Wrap(err))
+			}
+			buf := bytes.Buffer{}
+			format := expfmt.FmtText
+			encoder := expfmt.NewEncoder(&buf, format)
+			for _, family := range families {
+				if err := encoder.Encode(family); err != nil {
+					return NewErrorJSONResponse(Wrap(err))
+				}
+			}
+			return NewResponse(buf.Bytes(), nil, fasthttp.StatusOK, Header{Name: ContentTypeHeaderName, Value: string(format)})
+		},
+	}
+}
@@ -0,0 +1,52 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Well known middleware priorities, a higher priority runs earlier (outer) in the chain:
+// recovery -> request id -> tracing -> access log -> profiler -> firewall -> default (0) -> handler
+const (
+	MiddlewarePriorityRecovery  = 1000
+	MiddlewarePriorityRequestID = 900
+	MiddlewarePriorityTracing   = 800
+	MiddlewarePriorityAccessLog = 700
+	MiddlewarePriorityProfiler  = 600
+	MiddlewarePriorityFirewall  = 500
+	MiddlewarePriorityDefault   = 0
+)
+
+// NamedMiddleware middleware positioned by priority instead of its index in the config
+type NamedMiddleware struct {
+	Name       string
+	Priority   int
+	Middleware Middleware
+}
+
+// SortMiddlewares orders middlewares by descending priority, equal priorities keep the registration order.
+// RouterConfig.Middlewares are registered first with the default priority. Duplicate names panic.
+func SortMiddlewares(plain []Middleware, named ...NamedMiddleware) MiddlewareChain {
+	entries := make([]NamedMiddleware, 0, len(plain)+len(named))
+	for _, m := range plain {
+		entries = append(entries, NamedMiddleware{Priority: MiddlewarePriorityDefault, Middleware: m})
+	}
+	names := make(map[string]struct{}, len(named))
+	for _, m := range named {
+		if m.Name != "" {
+			if _, ok := names[m.Name]; ok {
+				panic(fmt.Sprintf("middleware '%s' is already registered", m.Name))
+			}
+			names[m.Name] = struct{}{}
+		}
+		entries = append(entries, m)
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Priority > entries[j].Priority
+	})
+	chain := make(MiddlewareChain, len(entries))
+	for i, e := range entries {
+		chain[i] = e.Middleware
+	}
+	return chain
+}
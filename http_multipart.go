@@ -0,0 +1,183 @@
+package core
+
+import (
+	"database/sql"
+	"encoding"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type UploadedFile struct {
+	Field       string
+	Filename    string
+	Size        int64
+	ContentType string
+	header      *multipart.FileHeader
+}
+
+func (f UploadedFile) Open() (multipart.File, error) {
+	return f.header.Open()
+}
+
+type UploadedFiles map[string][]UploadedFile
+
+func (f UploadedFiles) First(field string) (UploadedFile, bool) {
+	files := f[field]
+	if len(files) == 0 {
+		return UploadedFile{}, false
+	}
+	return files[0], true
+}
+
+// ParseMultipart binds multipart/form-data fields into dest by `form` tag (falls back to `json` tag)
+// and returns the uploaded files.
+func (r Request) ParseMultipart(dest interface{}) (UploadedFiles, error) {
+	if reflect.TypeOf(dest).Kind() != reflect.Ptr {
+		return nil, errors.New("destination must be of type pointer")
+	}
+	form, err := r.MultipartForm()
+	if err != nil {
+		return nil, BadRequestErr("Invalid multipart form")
+	}
+	if err := bindFormValues(dest, form.Value); err != nil {
+		return nil, err
+	}
+	files := UploadedFiles{}
+	for field, headers := range form.File {
+		for _, h := range headers {
+			files[field] = append(files[field], newUploadedFile(field, h))
+		}
+	}
+	return files, nil
+}
+
+// UploadedFile returns the first file uploaded under the given field
+func (r Request) UploadedFile(field string) (UploadedFile, error) {
+	h, err := r.FormFile(field)
+	if err != nil {
+		return UploadedFile{}, BadRequestErr(fmt.Sprintf("Missing file %s", field))
+	}
+	return newUploadedFile(field, h), nil
+}
+
+func newUploadedFile(field string, h *multipart.FileHeader) UploadedFile {
+	return UploadedFile{
+		Field:       field,
+		Filename:    h.Filename,
+		Size:        h.Size,
+		ContentType: h.Header.Get("Content-Type"),
+		header:      h,
+	}
+}
+
+func bindFormValues(dest interface{}, values map[string][]string) error {
+	v := reflect.ValueOf(dest).Elem()
+	if v.Kind() != reflect.Struct {
+		return errors.New("destination must be a pointer to struct")
+	}
+	return bindFormStruct(v, values)
+}
+
+func bindFormStruct(v reflect.Value, values map[string][]string) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fv := v.Field(i)
+		if field.Anonymous && fv.Kind() == reflect.Struct {
+			if err := bindFormStruct(fv, values); err != nil {
+				return err
+			}
+			continue
+		}
+		if !fv.CanSet() {
+			continue
+		}
+		name := formFieldName(field)
+		if name == "-" {
+			continue
+		}
+		raw, ok := values[name]
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		if err := setFormValue(fv, raw); err != nil {
+			return BadRequestErr(fmt.Sprintf("Invalid value for field %s", name))
+		}
+	}
+	return nil
+}
+
+func formFieldName(field reflect.StructField) string {
+	for _, tag := range []string{"form", "json"} {
+		if name := strings.Split(field.Tag.Get(tag), ",")[0]; name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func setFormValue(fv reflect.Value, raw []string) error {
+	if fv.Kind() == reflect.Ptr {
+		ptr := reflect.New(fv.Type().Elem())
+		if err := setFormValue(ptr.Elem(), raw); err != nil {
+			return err
+		}
+		fv.Set(ptr)
+		return nil
+	}
+	if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(fv.Type(), len(raw), len(raw))
+		for i, r := range raw {
+			if err := setFormValue(slice.Index(i), []string{r}); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	}
+	value := raw[0]
+	// uuid.UUID, time.Time and custom types parse themselves
+	if fv.CanAddr() {
+		switch target := fv.Addr().Interface().(type) {
+		case encoding.TextUnmarshaler:
+			return target.UnmarshalText([]byte(value))
+		case sql.Scanner:
+			return target.Scan(value)
+		}
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("unsupported form field kind %s", fv.Kind())
+	}
+	return nil
+}
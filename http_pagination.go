@@ -0,0 +1,73 @@
+package core
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Pagination query parameters, page/per_page are used when limit/offset are absent
+const (
+	QueryParamLimit   = "limit"
+	QueryParamOffset  = "offset"
+	QueryParamPage    = "page"
+	QueryParamPerPage = "per_page"
+
+	TotalCountHeaderName = "X-Total-Count"
+)
+
+type PaginationMeta struct {
+	Total   uint64 `json:"total"`
+	Limit   uint32 `json:"limit"`
+	Offset  uint32 `json:"offset"`
+	HasMore bool   `json:"has_more"`
+}
+
+// PaginatedList envelope of list responses
+type PaginatedList struct {
+	Items interface{}    `json:"items"`
+	Meta  PaginationMeta `json:"meta"`
+}
+
+// NewPaginatedJsonResponse wraps items with pagination meta and sets the X-Total-Count header
+func NewPaginatedJsonResponse(items interface{}, total uint64, pag Pagination, headers ...Header) Response {
+	meta := PaginationMeta{
+		Total:   total,
+		Limit:   pag.Limit,
+		Offset:  pag.Offset,
+		HasMore: uint64(pag.Offset)+uint64(pag.Limit) < total,
+	}
+	headers = append(headers, Header{Name: TotalCountHeaderName, Value: strconv.FormatUint(total, 10)})
+	return NewJsonResponse(PaginatedList{Items: items, Meta: meta}, fasthttp.StatusOK, nil, headers...)
+}
+
+// Pagination reads limit/offset or page (1 based)/per_page from the query string,
+// invalid values fall back to defaults and the limit is clamped to maxLimit (zero disables clamping).
+// A page whose offset does not fit the uint32 offset is a BadRequestErr.
+func (r Request) Pagination(defaults Pagination, maxLimit uint32) (Pagination, error) {
+	args := r.QueryArgs()
+	queryUint := func(name string) (uint32, bool) {
+		v, err := strconv.ParseUint(string(args.Peek(name)), 10, 32)
+		return uint32(v), err == nil
+	}
+	pager := defaults
+	if limit, ok := queryUint(QueryParamLimit); ok && limit > 0 {
+		pager.Limit = limit
+	} else if perPage, ok := queryUint(QueryParamPerPage); ok && perPage > 0 {
+		pager.Limit = perPage
+	}
+	if maxLimit > 0 && pager.Limit > maxLimit {
+		pager.Limit = maxLimit
+	}
+	if offset, ok := queryUint(QueryParamOffset); ok {
+		pager.Offset = offset
+	} else if page, ok := queryUint(QueryParamPage); ok && page > 0 {
+		offset := uint64(page-1) * uint64(pager.Limit)
+		if offset > math.MaxUint32 {
+			return defaults, BadRequestErr("Page out of range")
+		}
+		pager.Offset = uint32(offset)
+	}
+	return pager, nil
+}
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	PanicEventName = "core.http.panic"
+
+	PanicSourceHandler    = "handler"
+	PanicSourceSubscriber = "subscriber"
+)
+
+// PanicEvent dispatched for recovered handler panics and, with DispatcherOptions.DispatchPanics,
+// event subscriber panics, subscribe to PanicEventName to forward them to alerting
+type PanicEvent struct {
+	// Source PanicSourceHandler or PanicSourceSubscriber
+	Source    string
+	Value     interface{}
+	Stack     []Frame
+	Method    string
+	URI       string
+	Route     string
+	RequestID string
+	// Event name the panicking subscriber was called for
+	Event string
+}
+
+func NewPanicEvent(req Request, rec interface{}, stack []Frame) PanicEvent {
+	return PanicEvent{
+		Source:    PanicSourceHandler,
+		Value:     rec,
+		Stack:     stack,
+		Method:    string(req.Method()),
+		URI:       req.URI().String(),
+		Route:     req.Route().Pattern(),
+		RequestID: req.RequestID(),
+	}
+}
+
+// NewSubscriberPanicEvent request info is filled in when the event was dispatched with a Request
+func NewSubscriberPanicEvent(ctx context.Context, event string, rec interface{}, stack []Frame) PanicEvent {
+	if req, ok := ctx.(Request); ok {
+		e := NewPanicEvent(req, rec, stack)
+		e.Source, e.Event = PanicSourceSubscriber, event
+		return e
+	}
+	return PanicEvent{
+		Source:    PanicSourceSubscriber,
+		Value:     rec,
+		Stack:     stack,
+		RequestID: RequestIDValue.GetOrZero(ctx),
+		Event:     event,
+	}
+}
+
+func (e PanicEvent) GetName() string {
+	return PanicEventName
+}
+
+type PanicDetails struct {
+	Error string  `json:"error"`
+	Stack []Frame `json:"stack"`
+}
+
+// NewRecoveryMiddleware converts handler panics into JSON error responses.
+// In debug mode the panic value and stack frames are returned in the body,
+// a PanicEvent is dispatched when the dispatcher is passed.
+func NewRecoveryMiddleware(debug bool, dispatcher ...EventDispatcher) Middleware {
+	var events EventDispatcher
+	if len(dispatcher) > 0 {
+		events = dispatcher[0]
+	}
+	return func(req Request, next Handler) (resp Response) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			stack := panicFrames()
+			rec, stack = unwrapPanic(rec, stack)
+			req.Logger().Error("handler recovered from panic", Fields{"panic": rec, "stack": stack})
+			dispatchPanicEvent(req, events, NewPanicEvent(req, rec, stack))
+			err := InternalServerErr(fmt.Sprint(rec))
+			if debug {
+				resp = NewJsonResponse(PanicDetails{Error: fmt.Sprint(rec), Stack: stack}, fasthttp.StatusInternalServerError, err)
+				return
+			}
+			resp = NewErrorJSONResponse(InternalServerErr())
+		}()
+		return next(req)
+	}
+}
+
+func dispatchPanicEvent(ctx context.Context, dispatcher EventDispatcher, event PanicEvent) {
+	if err := dispatchEventSilent(ctx, dispatcher, event); err != nil {
+		LoggerFromContext(ctx).Error(fmt.Sprintf("panic event dispatch: %s", err))
+	}
+}
+
+// panicFrames returns the stack of the panicking goroutine, called from a deferred recover
+func panicFrames() []Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(4, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, Frame{Name: frame.Function, File: frame.File, Line: strconv.Itoa(frame.Line)})
+		if !more {
+			break
+		}
+	}
+	return stack
+}
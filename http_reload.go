@@ -0,0 +1,63 @@
+package core
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+)
+
+// ListenerFDEnvName set for a process started by graceful reload, holds the inherited listener descriptor
+const ListenerFDEnvName = "PUNQY_LISTENER_FD"
+
+type ServerConfig struct {
+	Port int
+	// GracefulReload on SIGHUP starts a new process of the same binary handing over the listening socket,
+	// the old one stops accepting and drains in-flight requests
+	GracefulReload bool
+}
+
+// listen takes over the listener passed by the parent process, or opens a new one
+func listen(port int) (net.Listener, error) {
+	fdEnv := os.Getenv(ListenerFDEnvName)
+	if fdEnv == "" {
+		return net.Listen("tcp4", fmt.Sprintf(":%d", port))
+	}
+	os.Unsetenv(ListenerFDEnvName)
+	fd, err := strconv.Atoi(fdEnv)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", ListenerFDEnvName, fdEnv, err)
+	}
+	file := os.NewFile(uintptr(fd), "listener")
+	defer file.Close()
+	return net.FileListener(file)
+}
+
+// reload starts a copy of the current process inheriting the listener
+func reload(ln net.Listener) (*os.Process, error) {
+	tcp, ok := ln.(*net.TCPListener)
+	if !ok {
+		return nil, fmt.Errorf("listener %T can not be inherited", ln)
+	}
+	file, err := tcp.File()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	executable, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	// ExtraFiles start with descriptor 3
+	cmd.ExtraFiles = []*os.File{file}
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%d", ListenerFDEnvName, 3))
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return cmd.Process, nil
+}
@@ -0,0 +1,56 @@
+package core
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeaderName   = "X-Request-ID"
+	RequestValueRequestID = "request-id"
+	LogFieldRequestID     = "request_id"
+)
+
+// incoming ids are echoed to logs, headers and profile file names so only safe ones are accepted
+var requestIDRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestIDMiddleware assigns the request id and echoes it in the response header
+func RequestIDMiddleware(req Request, next Handler) Response {
+	id := req.RequestID()
+	resp := next(req)
+	if !isTimedOut(resp) {
+		req.Response.Header.Set(RequestIDHeaderName, id)
+	}
+	return resp
+}
+
+// RequestID returns the correlation id of the request, taken from the X-Request-ID header
+// when valid or generated otherwise. The id is stored on the request on first access.
+func (r Request) RequestID() string {
+	if id, ok := RequestIDValue.Get(r); ok {
+		return id
+	}
+	id := string(r.Request.Header.Peek(RequestIDHeaderName))
+	if !requestIDRe.MatchString(id) {
+		id = uuid.New().String()
+	}
+	RequestIDValue.Set(r, id)
+	return id
+}
+
+// Logger returns the package logger tagged with the request id
+func (r Request) Logger() Logger {
+	return GetLogger().With(Fields{LogFieldRequestID: r.RequestID()})
+}
+
+// LoggerFromContext returns the request scoped logger when ctx carries a request id
+func LoggerFromContext(ctx context.Context) Logger {
+	if ctx != nil {
+		if id, ok := RequestIDValue.Get(ctx); ok {
+			return GetLogger().With(Fields{LogFieldRequestID: id})
+		}
+	}
+	return GetLogger()
+}
@@ -0,0 +1,51 @@
+package core
+
+import "context"
+
+// RequestValue string key of a request user value.
+//
+// Deprecated: use a typed RequestKey instead.
+type RequestValue string
+
+// RequestKey typed key of a value stored on the request (fasthttp user value).
+// Keys are plain strings, so the existing string keyed UserValue access keeps working.
+type RequestKey[T any] string
+
+// requestContextKey key of the values attached to plain contexts by WithValue,
+// a private type so they do not collide with the string keys of other packages
+type requestContextKey string
+
+// Well known request values
+var (
+	RouteValue           = RequestKey[Route](RequestValueRoute)
+	SecurityContextValue = RequestKey[SecurityContext](SecurityContextKey)
+	RequestIDValue       = RequestKey[string](RequestValueRequestID)
+	CSRFTokenValue       = RequestKey[string](RequestValueCSRFToken)
+	TraceContextValue    = RequestKey[context.Context](RequestValueTraceContext)
+	ProfileValue         = RequestKey[*Profile](profileContextKey)
+)
+
+// Get reads the value from a Request or from a plain context populated with WithValue,
+// false when it is missing or of another type
+func (k RequestKey[T]) Get(ctx context.Context) (T, bool) {
+	if v, ok := ctx.Value(requestContextKey(k)).(T); ok {
+		return v, true
+	}
+	v, ok := ctx.Value(string(k)).(T)
+	return v, ok
+}
+
+// GetOrZero like Get, returns the zero value when missing
+func (k RequestKey[T]) GetOrZero(ctx context.Context) T {
+	v, _ := k.Get(ctx)
+	return v
+}
+
+func (k RequestKey[T]) Set(req Request, v T) {
+	req.SetUserValue(string(k), v)
+}
+
+// WithValue attaches the value to a plain context, e.g. background jobs and tests
+func (k RequestKey[T]) WithValue(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, requestContextKey(k), v)
+}
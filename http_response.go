@@ -2,7 +2,8 @@ package core
 
 import (
 	"database/sql"
-	"encoding/json"
+	"net/http"
+	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/lib/pq"
@@ -15,6 +16,7 @@ const (
 	ContentTypeHeaderName        = "Content-type"
 	ApplicationJsonHeaderVal     = "application/json"
 	ApplicationTextHtmlHeaderVal = "text/html"
+	TextHtmlUTF8HeaderVal        = "text/html; charset=utf-8"
 )
 
 type response struct {
@@ -32,7 +34,7 @@ func NewHtmlResponse(bytes []byte, code int) Response {
 	return &response{bytes: bytes, code: code, headers: Headers{
 		{
 			Name:  ContentTypeHeaderName,
-			Value: ApplicationTextHtmlHeaderVal,
+			Value: TextHtmlUTF8HeaderVal,
 		},
 	}}
 }
@@ -41,7 +43,7 @@ func NewErrorHtmlResponse(err error, code int) Response {
 	return &response{bytes: []byte(err.Error()), error: err, code: code, headers: Headers{
 		{
 			Name:  ContentTypeHeaderName,
-			Value: ApplicationTextHtmlHeaderVal,
+			Value: TextHtmlUTF8HeaderVal,
 		},
 	}}
 }
@@ -65,6 +67,23 @@ func NewOKJsonResponse() Response {
 	return NewJsonResponse("OK", fasthttp.StatusOK, nil)
 }
 
+// sniffContentType sets the content type of generic byte responses without one from the body
+func sniffContentType(res Response) Response {
+	r, ok := res.(*response)
+	if !ok || len(r.bytes) == 0 {
+		return res
+	}
+	for _, h := range r.headers {
+		if strings.EqualFold(h.Name, ContentTypeHeaderName) {
+			return res
+		}
+	}
+	headers := make(Headers, 0, len(r.headers)+1)
+	headers = append(headers, r.headers...)
+	r.headers = append(headers, Header{Name: ContentTypeHeaderName, Value: http.DetectContentType(r.bytes)})
+	return r
+}
+
 func (r response) GetBytes() ([]byte, error) {
 	return r.bytes, nil
 }
@@ -113,7 +132,7 @@ func NewJsonResponse(data interface{}, code int, error error, headers ...Header)
 }
 
 func (r jsonResponse) GetBytes() ([]byte, error) {
-	marshaled, err := json.Marshal(r.data)
+	marshaled, err := marshalJSON(r.data)
 	if err != nil {
 		return nil, err
 	}
@@ -144,27 +163,35 @@ func (r *jsonResponse) SetHeaders(headers Headers) {
 	r.headers = headers
 }
 
+// NewErrorJSONResponse maps the error to its status code and message, the message is translated
+// to the request locale with the package Translator when the router writes the response, see SetTranslator
 func NewErrorJSONResponse(e error, headers ...Header) Response {
 	if e == nil {
 		return NewJsonResponse(nil, fasthttp.StatusOK, e, headers...)
 	}
+	data, code, err := errorPayload(e)
+	return errorJSONResponse{jsonResponse: NewJsonResponse(data, code, err, headers...).(jsonResponse), source: e}
+}
+
+// errorPayload maps an error to the response data, status code and the error kept on the response
+func errorPayload(e error) (interface{}, int, error) {
 	var errs validation.Errors
 	if ok := errors.As(e, &errs); ok {
-		return NewJsonResponse(errs, fasthttp.StatusUnprocessableEntity, NewUnprocessableEntityErr())
+		return errs, fasthttp.StatusUnprocessableEntity, NewUnprocessableEntityErr()
 	}
 	if errors.Is(e, sql.ErrNoRows) {
-		return NewJsonResponse(e, fasthttp.StatusNotFound, e)
+		return e, fasthttp.StatusNotFound, e
 	}
 	var driverErr *pq.Error
 	if ok := errors.Is(e, driverErr); ok {
 		if driverErr.Code == ErrLockNotAvailable {
-			return NewJsonResponse("Object is being used by another transaction", fasthttp.StatusNotAcceptable, e)
+			return "Object is being used by another transaction", fasthttp.StatusNotAcceptable, e
 		}
 		if driverErr.Code == ErrRowCheckConstraint {
-			return NewJsonResponse("Failed row constraint check", fasthttp.StatusNotAcceptable, e)
+			return "Failed row constraint check", fasthttp.StatusNotAcceptable, e
 		}
 		if driverErr.Code == ErrUniqueConstraint {
-			return NewJsonResponse("Conflict", fasthttp.StatusConflict, e)
+			return "Conflict", fasthttp.StatusConflict, e
 		}
 	}
 
@@ -173,5 +200,5 @@ func NewErrorJSONResponse(e error, headers ...Header) Response {
 	if errors.As(e, &er) {
 		nextCode = er.GetCode()
 	}
-	return NewJsonResponse(e.Error(), nextCode, e, headers...)
+	return e.Error(), nextCode, e
 }
@@ -2,18 +2,19 @@ package core
 
 import (
 	"fmt"
+	"net/url"
+	"regexp"
 	"strings"
 
 	fasthttprouter "github.com/fasthttp/router"
-	logger "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 	"github.com/valyala/fasthttp/pprofhandler"
 )
 
-type RequestValue string
-
 const (
 	RequestValueRoute = "route"
+	// AttrMaxBodySize per route request body limit in bytes, overrides RouterConfig.MaxBodySize
+	AttrMaxBodySize = "max_body_size"
 )
 
 type MethodHandlerMap map[string]func(path string, handler fasthttp.RequestHandler)
@@ -21,6 +22,14 @@ type MethodHandlerMap map[string]func(path string, handler fasthttp.RequestHandl
 type StaticFiles struct {
 	Path    string
 	RootDir string
+	// CacheControl header of the served files, e.g. "public, max-age=3600", empty leaves it unset
+	CacheControl string
+	// ETag adds a weak ETag built from the file size and modification time, If-None-Match is answered with 304
+	ETag bool
+	// Compress serves gzip/brotli encoded files to accepting clients, compressed copies are cached next to the files
+	Compress bool
+	// Immutable caches content hashed file names (app.3f2a1b9c.js) and ?v= versioned urls, see TemplatingConfig.AssetHash, for a year
+	Immutable bool
 }
 
 type RouterConfig struct {
@@ -29,8 +38,21 @@ type RouterConfig struct {
 	WSHandler       fasthttp.RequestHandler
 	NotFoundHandler fasthttp.RequestHandler
 	Middlewares     []Middleware
-	StaticFiles     *StaticFiles
-	PprofEnabled    bool
+	// NamedMiddlewares are merged with Middlewares by priority, see SortMiddlewares
+	NamedMiddlewares []NamedMiddleware
+	StaticFiles      *StaticFiles
+	PprofEnabled     bool
+	// MaxBodySize global request body limit in bytes, zero disables the check
+	MaxBodySize int
+	// ErrorRenderer renders router level errors (panics, oversized bodies, unmatched routes), JSON translated
+	// to the request locale by default, see NewErrorJSONResponse
+	ErrorRenderer ErrorRenderer
+	// Debug includes the panic value and stack frames in the recovered handler response
+	Debug bool
+	// Dispatcher receives a PanicEvent for every recovered handler panic
+	Dispatcher EventDispatcher
+	// SniffContentType detects the content type of NewResponse bodies without one, see http.DetectContentType
+	SniffContentType bool
 }
 
 const (
@@ -53,12 +75,84 @@ func CORS(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 type Router interface {
 	Apply(config Route, router *fasthttprouter.Router, ancestorPattern string)
 	GetMux() *fasthttprouter.Router
+	// MaxBodySize the largest body limit of all routes, used to align the server limit
+	MaxBodySize() int
+	// URL path of the named route, params are name/value pairs filling {name} placeholders,
+	// the remaining pairs are appended as query string
+	URL(name string, params ...interface{}) (string, error)
 }
 
 type router struct {
-	mux        *fasthttprouter.Router
-	routes     []Route
-	middleware Middleware
+	mux         *fasthttprouter.Router
+	routes      []Route
+	middleware  Middleware
+	maxBodySize int
+	largestBody int
+	renderError ErrorRenderer
+	named       map[string]string
+	debug       bool
+	dispatcher  EventDispatcher
+	sniff       bool
+}
+
+func (r *router) MaxBodySize() int {
+	return r.largestBody
+}
+
+func (r *router) bodyLimit(route Route) int {
+	if !route.Attr.Has(AttrMaxBodySize) {
+		return r.maxBodySize
+	}
+	switch v := route.Attr.Get(AttrMaxBodySize).(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case uint32:
+		return int(v)
+	}
+	return r.maxBodySize
+}
+
+func (r *router) URL(name string, params ...interface{}) (string, error) {
+	path, ok := r.named[name]
+	if !ok {
+		return "", fmt.Errorf("route '%s' does not exist", name)
+	}
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route '%s' params must be name/value pairs", name)
+	}
+	query := url.Values{}
+	for i := 0; i < len(params); i += 2 {
+		key := fmt.Sprint(params[i])
+		val := fmt.Sprint(params[i+1])
+		placeholder := routeParamRe(key)
+		if placeholder.MatchString(path) {
+			path = placeholder.ReplaceAllLiteralString(path, url.PathEscape(val))
+			continue
+		}
+		query.Add(key, val)
+	}
+	if strings.Contains(path, "?}") {
+		path = strings.TrimRight(optionalRouteParamRe.ReplaceAllString(path, ""), "/")
+		if path == "" {
+			path = "/"
+		}
+	}
+	if strings.Contains(path, "{") {
+		return "", fmt.Errorf("route '%s' is missing params for %s", name, path)
+	}
+	if len(query) > 0 {
+		path = fmt.Sprintf("%s?%s", path, query.Encode())
+	}
+	return path, nil
+}
+
+var optionalRouteParamRe = regexp.MustCompile(`/?\{[^}]+\?\}`)
+
+// routeParamRe matches {name}, {name?} and {name:regex} placeholders
+func routeParamRe(name string) *regexp.Regexp {
+	return regexp.MustCompile(fmt.Sprintf(`\{%s(?:\?|:[^}]*)?\}`, regexp.QuoteMeta(name)))
 }
 
 func (r *router) GetMux() *fasthttprouter.Router {
@@ -68,14 +162,24 @@ func (r *router) GetMux() *fasthttprouter.Router {
 func NewRouter(cfg RouterConfig) Router {
 	mux := fasthttprouter.New()
 	mux.RedirectTrailingSlash = false
+	renderError := cfg.ErrorRenderer
+	if renderError == nil {
+		renderError = func(req Request, err error) Response {
+			return localize(NewErrorJSONResponse(err), string(req.Request.Header.Peek(AcceptLanguageHeaderName)))
+		}
+	}
 	if cfg.NotFoundHandler != nil {
 		mux.NotFound = cfg.NotFoundHandler
+	} else if cfg.ErrorRenderer != nil {
+		mux.NotFound = func(ctx *fasthttp.RequestCtx) {
+			writeResponse(ctx, renderError(NewRequest(ctx, Route{}), ObjectNotFoundErr()))
+		}
 	}
 	if cfg.GlobalHandler != nil {
 		mux.GlobalOPTIONS = cfg.GlobalHandler
 	}
 	if cfg.StaticFiles != nil {
-		mux.ServeFiles(cfg.StaticFiles.Path, cfg.StaticFiles.RootDir)
+		serveStaticFiles(mux, *cfg.StaticFiles)
 	}
 	if cfg.WSHandler != nil {
 		mux.GET("/ws", cfg.WSHandler)
@@ -83,7 +187,17 @@ func NewRouter(cfg RouterConfig) Router {
 	if cfg.PprofEnabled {
 		mux.GET("/debug/pprof/{profile:*}", pprofhandler.PprofHandler)
 	}
-	router := &router{mux: mux, middleware: chainMiddleware(cfg.Middlewares...)}
+	router := &router{
+		mux:         mux,
+		middleware:  chainMiddleware(SortMiddlewares(cfg.Middlewares, cfg.NamedMiddlewares...)...),
+		maxBodySize: cfg.MaxBodySize,
+		largestBody: cfg.MaxBodySize,
+		renderError: renderError,
+		named:       make(map[string]string),
+		debug:       cfg.Debug,
+		dispatcher:  cfg.Dispatcher,
+		sniff:       cfg.SniffContentType,
+	}
 	router.Apply(cfg.Routing, mux, "")
 	return router
 }
@@ -113,6 +227,21 @@ func (r *router) Apply(route Route, router *fasthttprouter.Router, ancestorPatte
 		return
 	}
 	if route.Handler != nil {
+		if limit := r.bodyLimit(route); limit > r.largestBody {
+			r.largestBody = limit
+		}
+		if attr, ok := route.Attr[AttrRoles]; ok {
+			if _, err := requiredRoles(attr); err != nil {
+				panic(fmt.Sprintf("route '%s': %s", path, err))
+			}
+		}
+		if route.Name != "" {
+			if _, ok := r.named[route.Name]; ok {
+				panic(fmt.Sprintf("route name '%s' is already registered", route.Name))
+			}
+			r.named[route.Name] = path
+		}
+		route.pattern = path
 		handler := r.createHandler(route)
 		mm := MethodHandlerMap{
 			Get:     router.GET,
@@ -133,26 +262,66 @@ func (r *router) Apply(route Route, router *fasthttprouter.Router, ancestorPatte
 }
 
 func (r *router) createHandler(route Route) fasthttp.RequestHandler {
+	bodyLimit := r.bodyLimit(route)
 	return func(ctx *fasthttp.RequestCtx) {
+		req := NewRequest(ctx, route)
+		var res Response
 		defer func() {
 			rec := recover()
 			if rec != nil {
-				ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-				ctx.Response.SetBodyString("internal error")
-				logger.Errorf("handler recovered from: %v", rec)
+				stack := panicFrames()
+				rec, stack = unwrapPanic(rec, stack)
+				req.Logger().Error("handler recovered from panic", Fields{"panic": rec, "stack": stack})
+				dispatchPanicEvent(req, r.dispatcher, NewPanicEvent(req, rec, stack))
+				if res != nil && isTimedOut(res) {
+					return
+				}
+				var fallback Response
+				if r.debug {
+					fallback = NewJsonResponse(PanicDetails{Error: fmt.Sprint(rec), Stack: stack}, fasthttp.StatusInternalServerError, nil)
+				} else {
+					fallback = r.renderError(req, InternalServerErr())
+				}
+				body, _ := fallback.GetBytes()
+				ctx.SetStatusCode(fallback.GetCode())
+				ctx.Response.Header.Set(ContentTypeHeaderName, ApplicationJsonHeaderVal)
+				fallback.GetHeaders().Each(func(name, val string) {
+					ctx.Response.Header.Set(name, val)
+				})
+				ctx.SetBody(body)
 			}
 		}()
-		res := r.middleware(NewRequest(ctx, route), route.Handler)
-		if ctx.Response.SetStatusCode(res.GetCode()); ctx.Response.StatusCode() == 0 {
-			ctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
+		if bodyLimit > 0 && len(ctx.Request.Body()) > bodyLimit {
+			res = r.renderError(req, RequestEntityTooLargeErr())
+		} else {
+			res = r.middleware(req, route.Handler)
+		}
+		if isTimedOut(res) {
+			// already answered by TimeoutErrorWithResponse, the handler may still be using ctx
+			return
 		}
-		res.GetHeaders().Each(func(name, val string) {
-			ctx.Response.Header.Add(name, val)
-		})
-		bytes, err := res.GetBytes()
-		if err != nil {
-			panic(err)
+		if r.sniff {
+			res = sniffContentType(res)
 		}
-		ctx.SetBody(bytes)
+		writeResponse(ctx, res)
+	}
+}
+
+func writeResponse(ctx *fasthttp.RequestCtx, res Response) {
+	res = localize(res, string(ctx.Request.Header.Peek(AcceptLanguageHeaderName)))
+	if ctx.Response.SetStatusCode(res.GetCode()); ctx.Response.StatusCode() == 0 {
+		ctx.Response.SetStatusCode(fasthttp.StatusInternalServerError)
+	}
+	res.GetHeaders().Each(func(name, val string) {
+		ctx.Response.Header.Add(name, val)
+	})
+	if stream, ok := res.(StreamResponse); ok {
+		ctx.SetBodyStreamWriter(stream.WriteStream)
+		return
+	}
+	bytes, err := res.GetBytes()
+	if err != nil {
+		panic(err)
 	}
+	ctx.SetBody(bytes)
 }
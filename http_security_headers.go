@@ -0,0 +1,87 @@
+package core
+
+import "strings"
+
+const (
+	DefaultContentTypeOptions      = "nosniff"
+	DefaultFrameOptions            = "DENY"
+	DefaultContentSecurityPolicy   = "default-src 'self'"
+	DefaultReferrerPolicy          = "strict-origin-when-cross-origin"
+	DefaultStrictTransportSecurity = "max-age=63072000; includeSubDomains"
+
+	StrictTransportSecurityHeaderName = "Strict-Transport-Security"
+)
+
+// SecurityHeadersConfig empty values fall back to defaults, list a header name in Disabled to omit it
+type SecurityHeadersConfig struct {
+	ContentTypeOptions      string
+	FrameOptions            string
+	ContentSecurityPolicy   string
+	ReferrerPolicy          string
+	StrictTransportSecurity string
+	Extra                   Headers
+	Disabled                []string
+}
+
+func (c SecurityHeadersConfig) headers() Headers {
+	value := func(v, def string) string {
+		if v == "" {
+			return def
+		}
+		return v
+	}
+	headers := Headers{
+		{Name: "X-Content-Type-Options", Value: value(c.ContentTypeOptions, DefaultContentTypeOptions)},
+		{Name: "X-Frame-Options", Value: value(c.FrameOptions, DefaultFrameOptions)},
+		{Name: "Content-Security-Policy", Value: value(c.ContentSecurityPolicy, DefaultContentSecurityPolicy)},
+		{Name: "Referrer-Policy", Value: value(c.ReferrerPolicy, DefaultReferrerPolicy)},
+		{Name: StrictTransportSecurityHeaderName, Value: value(c.StrictTransportSecurity, DefaultStrictTransportSecurity)},
+	}
+	headers = append(headers, c.Extra...)
+	enabled := make(Headers, 0, len(headers))
+	for _, h := range headers {
+		if !containsHeaderName(c.Disabled, h.Name) {
+			enabled = append(enabled, h)
+		}
+	}
+	return enabled
+}
+
+// NewSecurityHeadersMiddleware sets common hardening headers unless the handler response already has them.
+// HSTS is only sent over TLS.
+func NewSecurityHeadersMiddleware(config ...SecurityHeadersConfig) Middleware {
+	var cfg SecurityHeadersConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	headers := cfg.headers()
+	return func(req Request, next Handler) Response {
+		resp := next(req)
+		if isTimedOut(resp) {
+			return resp
+		}
+		var own []string
+		resp.GetHeaders().Each(func(name, val string) {
+			own = append(own, name)
+		})
+		headers.Each(func(name, val string) {
+			if containsHeaderName(own, name) {
+				return
+			}
+			if strings.EqualFold(name, StrictTransportSecurityHeaderName) && !req.IsTLS() {
+				return
+			}
+			req.Response.Header.Set(name, val)
+		})
+		return resp
+	}
+}
+
+func containsHeaderName(names []string, name string) bool {
+	for _, n := range names {
+		if strings.EqualFold(n, name) {
+			return true
+		}
+	}
+	return false
+}
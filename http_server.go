@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,8 +9,11 @@ import (
 	"os"
 	"os/signal"
 	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
 
-	logger "github.com/sirupsen/logrus"
 	"github.com/valyala/fasthttp"
 )
 
@@ -33,11 +37,65 @@ type MiddlewareChain []Middleware
 
 type Request struct {
 	*fasthttp.RequestCtx
+	// ctx overrides the context.Context behaviour of RequestCtx, e.g. to carry a deadline
+	ctx context.Context
+}
+
+// WithContext returns a copy of the request using ctx for Deadline, Done, Err and Value,
+// ctx should be derived from the request to keep its values reachable
+func (r Request) WithContext(ctx context.Context) Request {
+	r.ctx = ctx
+	return r
+}
+
+func (r Request) Deadline() (time.Time, bool) {
+	if r.ctx != nil {
+		return r.ctx.Deadline()
+	}
+	return r.RequestCtx.Deadline()
+}
+
+func (r Request) Done() <-chan struct{} {
+	if r.ctx != nil {
+		return r.ctx.Done()
+	}
+	return r.RequestCtx.Done()
+}
+
+func (r Request) Err() error {
+	if r.ctx != nil {
+		return r.ctx.Err()
+	}
+	return r.RequestCtx.Err()
+}
+
+func (r Request) Value(key interface{}) interface{} {
+	if r.ctx != nil {
+		return r.ctx.Value(key)
+	}
+	return r.RequestCtx.Value(key)
 }
 
 func NewRequest(requestCtx *fasthttp.RequestCtx, route Route) Request {
-	requestCtx.SetUserValue(RequestValueRoute, route)
-	return Request{RequestCtx: requestCtx}
+	req := Request{RequestCtx: requestCtx}
+	RouteValue.Set(req, route)
+	return req
+}
+
+// Route the matched route, zero Route when the request was not routed
+func (r Request) Route() Route {
+	return RouteValue.GetOrZero(r)
+}
+
+// RouteName name of the matched route, empty for unnamed routes
+func (r Request) RouteName() string {
+	return r.Route().Name
+}
+
+// Attr reads an attribute of the matched route
+func (r Request) Attr(key string) (interface{}, bool) {
+	value, ok := r.Route().Attr[key]
+	return value, ok
 }
 
 type Response interface {
@@ -74,23 +132,107 @@ func (a Attr) Get(key string) interface{} {
 }
 
 type Route struct {
+	// Name optional unique name used to generate the route url, see Router.URL
+	Name    string
 	Path    string
 	Method  string
 	Handler Handler
 	Inner   RouteList
 	Attr    Attr
+
+	// pattern full path including the ancestor paths, set when the route is applied to the router
+	pattern string
+}
+
+// Pattern the matched route path including the group prefixes, e.g. /api/users/{id}
+func (r Route) Pattern() string {
+	if r.pattern == "" {
+		return r.Path
+	}
+	return r.pattern
 }
 
 func (r Request) ParseForm(dest interface{}) error {
 	if reflect.TypeOf(dest).Kind() != reflect.Ptr {
 		return errors.New("destination must be of type pointer")
 	}
-	if err := json.Unmarshal(r.PostBody(), dest); err != nil {
+	if err := unmarshalJSON(r.PostBody(), dest); err != nil {
+		return BadRequestErr("Invalid json schema")
+	}
+	return nil
+}
+
+// ParseFormStrict like ParseForm but rejects unknown fields and requires the
+// fields tagged `required:"true"` to be present, only top level keys are checked.
+func (r Request) ParseFormStrict(dest interface{}) error {
+	t := reflect.TypeOf(dest)
+	if t.Kind() != reflect.Ptr {
+		return errors.New("destination must be of type pointer")
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(r.PostBody(), &raw); err != nil {
+		return BadRequestErr("Invalid json schema")
+	}
+	known, required := make(map[string]bool), make([]string, 0)
+	if t.Elem().Kind() == reflect.Struct {
+		collectJsonFields(t.Elem(), known, &required)
+	}
+	var missing, unknown []string
+	for _, name := range required {
+		if _, ok := raw[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	for name := range raw {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(missing) > 0 || len(unknown) > 0 {
+		sort.Strings(missing)
+		sort.Strings(unknown)
+		var problems []string
+		if len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("missing fields: %s", strings.Join(missing, ", ")))
+		}
+		if len(unknown) > 0 {
+			problems = append(problems, fmt.Sprintf("unknown fields: %s", strings.Join(unknown, ", ")))
+		}
+		return BadRequestErr("Invalid json schema,", strings.Join(problems, "; "))
+	}
+	decoder := json.NewDecoder(bytes.NewReader(r.PostBody()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(dest); err != nil {
 		return BadRequestErr("Invalid json schema")
 	}
 	return nil
 }
 
+func collectJsonFields(t reflect.Type, known map[string]bool, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			collectJsonFields(field.Type, known, required)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		known[name] = true
+		if field.Tag.Get("required") == "true" {
+			*required = append(*required, name)
+		}
+	}
+}
+
 func (r Request) Get(key string, def string) string {
 	if r.URI().QueryArgs().Has(key) {
 		return string(r.URI().QueryArgs().Peek(key))
@@ -99,42 +241,77 @@ func (r Request) Get(key string, def string) string {
 }
 
 type Server interface {
+	// Serve blocks until an interrupt or ctx is done, then shuts the server down gracefully
 	Serve(ctx context.Context)
 }
 
 type server struct {
-	router     Router
-	serverPort int
+	router Router
+	config ServerConfig
 }
 
 func NewHttpServer(router Router, serverPort int) Server {
+	return NewHttpServerWithConfig(router, ServerConfig{Port: serverPort})
+}
+
+func NewHttpServerWithConfig(router Router, config ServerConfig) Server {
 	e := server{
-		router:     router,
-		serverPort: serverPort,
+		router: router,
+		config: config,
 	}
 	return &e
 }
 
 func (s *server) Serve(ctx context.Context) {
-	logger.Infof("Http server listening port :%d", s.serverPort)
-	server := &fasthttp.Server{Handler: s.router.GetMux().Handler}
+	ln, err := listen(s.config.Port)
+	if err != nil {
+		GetLogger().Error("Http server listen failed", Fields{"error": err.Error()})
+		return
+	}
+	GetLogger().Info("Http server listening", Fields{"addr": ln.Addr().String()})
+	server := &fasthttp.Server{
+		Handler:            s.router.GetMux().Handler,
+		MaxRequestBodySize: s.router.MaxBodySize(),
+	}
 	interrupt := make(chan os.Signal, 1)
 	go func() {
-		if err := server.ListenAndServe(fmt.Sprintf(":%d", s.serverPort)); err != nil {
-			logger.Errorf("Http server down: %s", err)
+		if err := server.Serve(ln); err != nil {
+			GetLogger().Error("Http server down", Fields{"error": err.Error()})
 			interrupt <- os.Interrupt
 			return
 		}
 	}()
-	signal.Notify(interrupt, os.Interrupt)
-	<-interrupt
+	signals := []os.Signal{os.Interrupt}
+	if s.config.GracefulReload {
+		signals = append(signals, syscall.SIGHUP)
+	}
+	signal.Notify(interrupt, signals...)
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			break wait
+		case sig := <-interrupt:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			process, err := reload(ln)
+			if err != nil {
+				GetLogger().Error("Http server reload failed", Fields{"error": err.Error()})
+				continue
+			}
+			GetLogger().Info("Sig hangup received, listener handed over", Fields{"pid": process.Pid})
+			break wait
+		}
+	}
+	signal.Stop(interrupt)
 	s.shutdown(ctx, server)
 }
 
 func (s *server) shutdown(ctx context.Context, server *fasthttp.Server) {
-	logger.Info("Sig interrupt received, graceful shutdown")
+	GetLogger().Info("Graceful shutdown")
 	if err := server.Shutdown(); err != nil {
-		logger.Error("HttpServer shutdown err", err)
+		GetLogger().Error("HttpServer shutdown failed", Fields{"error": err.Error()})
 	}
 	ctx.Done()
 }
@@ -0,0 +1,148 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	ApplicationEventStreamHeaderVal = "text/event-stream"
+	DefaultSSEHeartbeat             = 15 * time.Second
+)
+
+// StreamResponse is written with fasthttp body stream writer instead of GetBytes
+type StreamResponse interface {
+	Response
+	WriteStream(w *bufio.Writer)
+}
+
+type SSEEvent struct {
+	ID    string
+	Event string
+	Data  string
+	Retry time.Duration
+}
+
+type SSEResponse interface {
+	StreamResponse
+	// Done is closed once the client disconnects, the request context is done or the channel is drained,
+	// producers should stop sending on it.
+	Done() <-chan struct{}
+}
+
+type sseResponse struct {
+	ctx       context.Context
+	events    <-chan SSEEvent
+	heartbeat time.Duration
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewSSEResponse streams the events of ch until ctx (usually the Request) is done. A disconnect is noticed
+// on the next write, heartbeats bound the delay for idle streams. With a Request, Done is also closed once
+// fasthttp releases it, so producers stop when the stream is never written (HEAD, replaced response, errors).
+// The request of a route behind NewTimeoutMiddleware is canceled once the handler returns, keep such routes out of it.
+func NewSSEResponse(ctx context.Context, ch <-chan SSEEvent, heartbeat ...time.Duration) SSEResponse {
+	hb := DefaultSSEHeartbeat
+	if len(heartbeat) > 0 && heartbeat[0] > 0 {
+		hb = heartbeat[0]
+	}
+	r := &sseResponse{ctx: ctx, events: ch, heartbeat: hb, done: make(chan struct{})}
+	if req, ok := ctx.(Request); ok {
+		// user values implementing io.Closer are closed when fasthttp resets the request, after the body is written
+		req.SetUserValue(fmt.Sprintf("punqy-sse-%p", r), r)
+	}
+	// the Done of a Request only fires on server shutdown, plain contexts may be canceled earlier
+	go func() {
+		select {
+		case <-ctx.Done():
+			r.close()
+		case <-r.done:
+		}
+	}()
+	return r
+}
+
+func (r *sseResponse) GetBytes() ([]byte, error) {
+	return nil, nil
+}
+
+func (r *sseResponse) GetError() error {
+	return nil
+}
+
+func (r *sseResponse) GetCode() int {
+	return fasthttp.StatusOK
+}
+
+func (r *sseResponse) GetHeaders() Headers {
+	return Headers{
+		{Name: ContentTypeHeaderName, Value: ApplicationEventStreamHeaderVal},
+		{Name: CacheControlHeaderName, Value: "no-cache"},
+		{Name: "Connection", Value: "keep-alive"},
+		{Name: "X-Accel-Buffering", Value: "no"},
+	}
+}
+
+func (r *sseResponse) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *sseResponse) close() {
+	r.closeOnce.Do(func() { close(r.done) })
+}
+
+// Close ends the stream, called by fasthttp when the request is released
+func (r *sseResponse) Close() error {
+	r.close()
+	return nil
+}
+
+func (r *sseResponse) WriteStream(w *bufio.Writer) {
+	defer r.close()
+	ticker := time.NewTicker(r.heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-r.done:
+			return
+		case evt, ok := <-r.events:
+			if !ok {
+				return
+			}
+			writeSSEEvent(w, evt)
+		case <-ticker.C:
+			if _, err := w.WriteString(": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+		// flush fails once the client went away
+		if err := w.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeSSEEvent(w *bufio.Writer, evt SSEEvent) {
+	if evt.ID != "" {
+		fmt.Fprintf(w, "id: %s\n", evt.ID)
+	}
+	if evt.Event != "" {
+		fmt.Fprintf(w, "event: %s\n", evt.Event)
+	}
+	if evt.Retry > 0 {
+		fmt.Fprintf(w, "retry: %d\n", evt.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(evt.Data, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	w.WriteString("\n")
+}
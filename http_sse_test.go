@@ -0,0 +1,25 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func TestSSEResponseDoneWithoutStreaming(t *testing.T) {
+	ctx := &fasthttp.RequestCtx{}
+	resp := NewSSEResponse(NewRequest(ctx, Route{}), make(chan SSEEvent))
+	select {
+	case <-resp.Done():
+		t.Fatal("expected the response to be pending before the request is released")
+	default:
+	}
+	// what fasthttp does once the response is sent, WriteStream is never called
+	ctx.ResetUserValues()
+	select {
+	case <-resp.Done():
+	case <-time.After(time.Second):
+		t.Fatal("expected Done to be closed once the request is released")
+	}
+}
@@ -0,0 +1,91 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	fasthttprouter "github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	CacheControlHeaderName = "Cache-Control"
+	ETagHeaderName         = "ETag"
+	IfNoneMatchHeaderName  = "If-None-Match"
+
+	ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+	staticFilePathParam = "filepath"
+	staticFilesSuffix   = "/{" + staticFilePathParam + ":*}"
+)
+
+// hashedAssetRe matches content hashed file names, e.g. app.3f2a1b9c.js
+var hashedAssetRe = regexp.MustCompile(`\.[0-9a-fA-F]{8,}\.[^./]+$`)
+
+func (s StaticFiles) customized() bool {
+	return s.CacheControl != "" || s.ETag || s.Compress || s.Immutable
+}
+
+// serveStaticFiles registers the static files handler, cache headers are applied when configured
+func serveStaticFiles(mux *fasthttprouter.Router, cfg StaticFiles) {
+	if !cfg.customized() {
+		mux.ServeFiles(cfg.Path, cfg.RootDir)
+		return
+	}
+	if !strings.HasSuffix(cfg.Path, staticFilesSuffix) {
+		panic(fmt.Sprintf("path must end with %s in path '%s'", staticFilesSuffix, cfg.Path))
+	}
+	fs := &fasthttp.FS{
+		Root:               cfg.RootDir,
+		IndexNames:         []string{"index.html"},
+		GenerateIndexPages: true,
+		AcceptByteRange:    true,
+		Compress:           cfg.Compress,
+	}
+	if slashes := strings.Count(strings.TrimSuffix(cfg.Path, staticFilesSuffix), "/"); slashes > 0 {
+		fs.PathRewrite = fasthttp.NewPathSlashesStripper(slashes)
+	}
+	files := fs.NewRequestHandler()
+	mux.GET(cfg.Path, func(ctx *fasthttp.RequestCtx) {
+		name, _ := ctx.UserValue(staticFilePathParam).(string)
+		var etag string
+		if cfg.ETag {
+			if info, err := os.Stat(filepath.Join(cfg.RootDir, filepath.Clean("/"+name))); err == nil && !info.IsDir() {
+				etag = fmt.Sprintf(`W/"%x-%x"`, info.ModTime().Unix(), info.Size())
+			}
+		}
+		if etag != "" && etagMatches(string(ctx.Request.Header.Peek(IfNoneMatchHeaderName)), etag) {
+			ctx.Response.Header.Set(ETagHeaderName, etag)
+			ctx.SetStatusCode(fasthttp.StatusNotModified)
+			return
+		}
+		files(ctx)
+		if code := ctx.Response.StatusCode(); code != fasthttp.StatusOK && code != fasthttp.StatusPartialContent {
+			return
+		}
+		if etag != "" {
+			ctx.Response.Header.Set(ETagHeaderName, etag)
+		}
+		if cfg.Immutable && (hashedAssetRe.MatchString(name) || ctx.QueryArgs().Has("v")) {
+			ctx.Response.Header.Set(CacheControlHeaderName, ImmutableCacheControl)
+		} else if cfg.CacheControl != "" {
+			ctx.Response.Header.Set(CacheControlHeaderName, cfg.CacheControl)
+		}
+	})
+}
+
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
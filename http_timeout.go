@@ -0,0 +1,93 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// NewTimeoutMiddleware runs the downstream handlers with a deadline of d, the request passed to them is
+// a context canceled once d elapses, so queries using it abort. A handler exceeding d is answered with
+// GatewayTimeoutErr while it keeps running in the background, fasthttp is told not to reuse the
+// request (RequestCtx.TimeoutErrorWithResponse) since the handler may still reference it.
+// The middleware then returns a timed out response, outer middlewares must not write to the
+// RequestCtx once they get one (see isTimedOut), the router does not write it either.
+func NewTimeoutMiddleware(d time.Duration) Middleware {
+	return func(req Request, next Handler) Response {
+		return runWithTimeout(req, d, next)
+	}
+}
+
+// runWithTimeout derives the deadline from the request context, so nested timeouts keep the shortest one
+func runWithTimeout(req Request, d time.Duration, next Handler) Response {
+	ctx, cancel := context.WithTimeout(req, d)
+	defer cancel()
+	timed := req.WithContext(ctx)
+
+	done := make(chan Response, 1)
+	panicked := make(chan recoveredPanic, 1)
+	go func() {
+		defer func() {
+			if rec := recover(); rec != nil {
+				stack := panicFrames()
+				rec, stack = unwrapPanic(rec, stack)
+				if ctx.Err() != nil {
+					// the caller may be gone, nobody else would report it
+					timed.Logger().Error("handler recovered from panic", Fields{"panic": rec, "stack": stack})
+				}
+				panicked <- recoveredPanic{value: rec, stack: stack}
+			}
+		}()
+		done <- next(timed)
+	}()
+
+	select {
+	case resp := <-done:
+		return resp
+	case p := <-panicked:
+		// raised again on the request goroutine for the router recovery, keeping the handler stack
+		panic(p)
+	case <-ctx.Done():
+		resp := localize(NewErrorJSONResponse(GatewayTimeoutErr()), string(req.Request.Header.Peek(AcceptLanguageHeaderName)))
+		body, _ := resp.GetBytes()
+		timeout := fasthttp.AcquireResponse()
+		defer fasthttp.ReleaseResponse(timeout)
+		timeout.SetStatusCode(resp.GetCode())
+		timeout.Header.SetContentType(ApplicationJsonHeaderVal)
+		timeout.SetBody(body)
+		req.TimeoutErrorWithResponse(timeout)
+		return timedOutResponse{Response: resp}
+	}
+}
+
+// timedOutResponse is returned once the request was answered through RequestCtx.TimeoutErrorWithResponse,
+// the abandoned handler may still use the RequestCtx so nothing may write to it anymore
+type timedOutResponse struct {
+	Response
+}
+
+// isTimedOut reports whether resp was already sent by a timeout, its RequestCtx must be left untouched
+func isTimedOut(resp Response) bool {
+	_, ok := resp.(timedOutResponse)
+	return ok
+}
+
+// recoveredPanic carries a panic recovered on another goroutine along with the stack it was raised with
+type recoveredPanic struct {
+	value interface{}
+	stack []Frame
+}
+
+func (p recoveredPanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// unwrapPanic returns the original value and stack of a panic raised again by runWithTimeout or the profiler
+func unwrapPanic(rec interface{}, stack []Frame) (interface{}, []Frame) {
+	if p, ok := rec.(recoveredPanic); ok {
+		return p.value, p.stack
+	}
+	return rec, stack
+}
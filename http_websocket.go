@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/fasthttp/websocket"
+	"github.com/valyala/fasthttp"
+)
+
+type WebSocketHandler interface {
+	// OnConnect called once the connection is upgraded, returning an error closes it
+	OnConnect(conn *WebSocketConn) error
+	// OnMessage called for every received message, returning an error closes the connection
+	OnMessage(conn *WebSocketConn, message []byte) error
+	// OnClose called once when the connection is closed, err is the reason
+	OnClose(conn *WebSocketConn, err error)
+}
+
+type WebSocketConfig struct {
+	ReadBufferSize  int
+	WriteBufferSize int
+	// CheckOrigin defaults to same origin check when nil
+	CheckOrigin func(ctx *fasthttp.RequestCtx) bool
+}
+
+// WebSocketConn holds the values captured from the upgraded request,
+// the request itself must not be used once the connection is hijacked.
+type WebSocketConn struct {
+	*websocket.Conn
+	RequestID       string
+	SecurityContext SecurityContext
+	Authenticated   bool
+	Route           Route
+	writeMu         sync.Mutex
+}
+
+// Send writes a text message, safe for concurrent use
+func (c *WebSocketConn) Send(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return c.WriteMessage(websocket.TextMessage, message)
+}
+
+// User returns the authenticated user of the upgraded request
+func (c *WebSocketConn) User() (UserInterface, bool) {
+	if !c.Authenticated {
+		return nil, false
+	}
+	return c.SecurityContext.User()
+}
+
+// NewWebSocketRoute creates a GET route upgrading to a websocket connection served by handler.
+// The route passes the router middlewares (firewall included) before the upgrade.
+func NewWebSocketRoute(path string, handler WebSocketHandler, config ...WebSocketConfig) Route {
+	var cfg WebSocketConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	upgrader := websocket.FastHTTPUpgrader{
+		ReadBufferSize:  cfg.ReadBufferSize,
+		WriteBufferSize: cfg.WriteBufferSize,
+		CheckOrigin:     cfg.CheckOrigin,
+	}
+	return Route{
+		Path:   path,
+		Method: Get,
+		Handler: func(req Request) Response {
+			securityContext, authenticated := req.SecurityContext()
+			route := req.Route()
+			requestID := req.RequestID()
+			err := upgrader.Upgrade(req.RequestCtx, func(c *websocket.Conn) {
+				serveWebSocket(handler, &WebSocketConn{
+					Conn:            c,
+					RequestID:       requestID,
+					SecurityContext: securityContext,
+					Authenticated:   authenticated,
+					Route:           route,
+				})
+			})
+			if err != nil {
+				return NewErrorJSONResponse(BadRequestErr(err.Error()))
+			}
+			return NewResponse(nil, nil, fasthttp.StatusSwitchingProtocols)
+		},
+	}
+}
+
+func serveWebSocket(handler WebSocketHandler, conn *WebSocketConn) {
+	logger := GetLogger().With(Fields{LogFieldRequestID: conn.RequestID})
+	var reason error
+	defer func() {
+		if rec := recover(); rec != nil {
+			logger.Error(fmt.Sprintf("websocket handler recovered from: %v", rec))
+			reason = fmt.Errorf("websocket handler panic: %v", rec)
+		}
+		if err := conn.Close(); err != nil {
+			logger.Debug(fmt.Sprintf("websocket close: %s", err))
+		}
+		handler.OnClose(conn, reason)
+	}()
+	if reason = handler.OnConnect(conn); reason != nil {
+		return
+	}
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			reason = err
+			return
+		}
+		if err := handler.OnMessage(conn, message); err != nil {
+			reason = err
+			return
+		}
+	}
+}
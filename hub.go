@@ -0,0 +1,230 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// HubOverflowPolicy what happens to a client whose buffer is full
+type HubOverflowPolicy int
+
+const (
+	// HubDropMessage drops the message for the slow client only
+	HubDropMessage HubOverflowPolicy = iota
+	// HubDisconnect unregisters and closes the slow client
+	HubDisconnect
+)
+
+const DefaultHubBufferSize = 64
+
+// HubClient receives the broadcast messages, *WebSocketConn implements it.
+// Clients implementing io.Closer are closed when disconnected by the overflow policy.
+type HubClient interface {
+	Send(message []byte) error
+}
+
+// HubMessage default encoding of events broadcast to the clients
+type HubMessage struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+type HubConfig struct {
+	// BufferSize messages queued per client, DefaultHubBufferSize by default
+	BufferSize int
+	Policy     HubOverflowPolicy
+	// Encode converts the event to the message sent, JSON encoded HubMessage by default
+	Encode func(event Event) ([]byte, error)
+}
+
+// Hub fans dispatched events out to the connected clients (websocket or SSE) subscribed to the event names
+type Hub interface {
+	// Register subscribes the client to the topics (event names), registering again adds topics
+	Register(client HubClient, topics ...string)
+	// Unregister removes the client from all topics, call it when the connection closes
+	Unregister(client HubClient)
+	// Publish broadcasts the message to the clients subscribed to topic
+	Publish(topic string, message []byte)
+	// Subscriber broadcasts every event it receives, subscribe it to the dispatcher for the topics
+	Subscriber() EventSubscriber
+	// Bind subscribes the hub to the topics of the dispatcher
+	Bind(dispatcher EventDispatcher, topics ...string)
+	// SSE returns a response streaming the topics to the client until it disconnects or ctx is done
+	SSE(ctx context.Context, topics ...string) SSEResponse
+	Close()
+}
+
+type hubClient struct {
+	client    HubClient
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type hub struct {
+	mu      sync.RWMutex
+	clients map[HubClient]*hubClient
+	topics  map[string]map[*hubClient]struct{}
+	config  HubConfig
+}
+
+func NewHub(config ...HubConfig) Hub {
+	var cfg HubConfig
+	if len(config) > 0 {
+		cfg = config[0]
+	}
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = DefaultHubBufferSize
+	}
+	if cfg.Encode == nil {
+		cfg.Encode = func(event Event) ([]byte, error) {
+			return marshalJSON(HubMessage{Event: event.GetName(), Data: event})
+		}
+	}
+	return &hub{
+		clients: make(map[HubClient]*hubClient),
+		topics:  make(map[string]map[*hubClient]struct{}),
+		config:  cfg,
+	}
+}
+
+func (h *hub) Register(client HubClient, topics ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hc, ok := h.clients[client]
+	if !ok {
+		hc = &hubClient{client: client, queue: make(chan []byte, h.config.BufferSize), done: make(chan struct{})}
+		h.clients[client] = hc
+		go h.pump(hc)
+	}
+	for _, topic := range topics {
+		if h.topics[topic] == nil {
+			h.topics[topic] = make(map[*hubClient]struct{})
+		}
+		h.topics[topic][hc] = struct{}{}
+	}
+}
+
+func (h *hub) Unregister(client HubClient) {
+	h.mu.Lock()
+	hc, ok := h.clients[client]
+	h.mu.Unlock()
+	if ok {
+		h.remove(hc, false)
+	}
+}
+
+func (h *hub) Publish(topic string, message []byte) {
+	var slow []*hubClient
+	h.mu.RLock()
+	for hc := range h.topics[topic] {
+		select {
+		case hc.queue <- message:
+		default:
+			if h.config.Policy == HubDisconnect {
+				slow = append(slow, hc)
+			} else {
+				GetLogger().Debug("hub: client buffer full, message dropped", Fields{"topic": topic})
+			}
+		}
+	}
+	h.mu.RUnlock()
+	for _, hc := range slow {
+		GetLogger().Warn("hub: client buffer full, disconnecting", Fields{"topic": topic})
+		h.remove(hc, true)
+	}
+}
+
+func (h *hub) Subscriber() EventSubscriber {
+	return func(ctx context.Context, event Event) error {
+		message, err := h.config.Encode(event)
+		if err != nil {
+			return err
+		}
+		h.Publish(event.GetName(), message)
+		return nil
+	}
+}
+
+func (h *hub) Bind(dispatcher EventDispatcher, topics ...string) {
+	subscriber := h.Subscriber()
+	for _, topic := range topics {
+		dispatcher.Subscribe(topic, subscriber)
+	}
+}
+
+func (h *hub) SSE(ctx context.Context, topics ...string) SSEResponse {
+	events := make(chan SSEEvent)
+	resp := NewSSEResponse(ctx, events)
+	client := &sseHubClient{events: events, done: resp.Done()}
+	h.Register(client, topics...)
+	go func() {
+		<-resp.Done()
+		h.Unregister(client)
+	}()
+	return resp
+}
+
+func (h *hub) Close() {
+	h.mu.RLock()
+	clients := make([]*hubClient, 0, len(h.clients))
+	for _, hc := range h.clients {
+		clients = append(clients, hc)
+	}
+	h.mu.RUnlock()
+	for _, hc := range clients {
+		h.remove(hc, true)
+	}
+}
+
+// pump writes the queued messages, a failed send means the client went away
+func (h *hub) pump(hc *hubClient) {
+	for {
+		select {
+		case <-hc.done:
+			return
+		case message := <-hc.queue:
+			if err := hc.client.Send(message); err != nil {
+				GetLogger().Debug("hub: send failed, removing client", Fields{"error": err.Error()})
+				h.remove(hc, true)
+				return
+			}
+		}
+	}
+}
+
+func (h *hub) remove(hc *hubClient, closeClient bool) {
+	h.mu.Lock()
+	delete(h.clients, hc.client)
+	for topic, clients := range h.topics {
+		delete(clients, hc)
+		if len(clients) == 0 {
+			delete(h.topics, topic)
+		}
+	}
+	h.mu.Unlock()
+	hc.closeOnce.Do(func() {
+		close(hc.done)
+		if closer, ok := hc.client.(interface{ Close() error }); ok && closeClient {
+			closer.Close()
+		}
+	})
+}
+
+var errHubClientGone = errors.New("hub client disconnected")
+
+// sseHubClient feeds hub messages into an SSE response
+type sseHubClient struct {
+	events chan<- SSEEvent
+	done   <-chan struct{}
+}
+
+func (c *sseHubClient) Send(message []byte) error {
+	select {
+	case c.events <- SSEEvent{Data: string(message)}:
+		return nil
+	case <-c.done:
+		return errHubClientGone
+	}
+}
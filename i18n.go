@@ -0,0 +1,76 @@
+package core
+
+import (
+	"strings"
+)
+
+const (
+	AcceptLanguageHeaderName = "Accept-Language"
+	DefaultLocale            = "en"
+)
+
+// Translator resolves a message for the locale, the message itself is returned when there is no translation
+type Translator interface {
+	Translate(locale, message string) string
+}
+
+// MessageCatalog locale => message => translation, keys are the english messages, e.g.
+//
+//	MessageCatalog{"de": {"Not found": "Nicht gefunden"}}
+type MessageCatalog map[string]map[string]string
+
+// Translate falls back from a regional locale (de-CH) to its language (de)
+func (c MessageCatalog) Translate(locale, message string) string {
+	locale = strings.ToLower(locale)
+	for locale != "" {
+		if translated, ok := c[locale][message]; ok {
+			return translated
+		}
+		i := strings.LastIndexByte(locale, '-')
+		if i < 0 {
+			break
+		}
+		locale = locale[:i]
+	}
+	return message
+}
+
+type identityTranslator struct{}
+
+func (identityTranslator) Translate(_, message string) string {
+	return message
+}
+
+var packageTranslator Translator = identityTranslator{}
+
+func SetTranslator(t Translator) {
+	if t == nil {
+		t = identityTranslator{}
+	}
+	packageTranslator = t
+}
+
+func GetTranslator() Translator {
+	return packageTranslator
+}
+
+// Locale the preferred language of the Accept-Language header, DefaultLocale when absent
+func (r Request) Locale() string {
+	return parseAcceptLanguage(string(r.Request.Header.Peek(AcceptLanguageHeaderName)))
+}
+
+// Translate the message for the request locale
+func (r Request) Translate(message string) string {
+	return GetTranslator().Translate(r.Locale(), message)
+}
+
+// parseAcceptLanguage the first language with the highest q, DefaultLocale when none is acceptable
+func parseAcceptLanguage(header string) string {
+	locale, best := DefaultLocale, 0.0
+	for _, lang := range parseQualityValues(header) {
+		if lang.value != "*" && lang.q > best {
+			locale, best = lang.value, lang.q
+		}
+	}
+	return locale
+}
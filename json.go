@@ -0,0 +1,30 @@
+package core
+
+import "encoding/json"
+
+type JSONMarshaler func(v interface{}) ([]byte, error)
+
+type JSONUnmarshaler func(data []byte, v interface{}) error
+
+var (
+	marshalJSON   JSONMarshaler   = json.Marshal
+	unmarshalJSON JSONUnmarshaler = json.Unmarshal
+)
+
+// SetJSONMarshaler replaces the marshaler of JSON responses and profiles, e.g. with jsoniter or segmentio/encoding.
+// Must be called on startup before serving, nil restores encoding/json
+func SetJSONMarshaler(marshaler JSONMarshaler) {
+	if marshaler == nil {
+		marshaler = json.Marshal
+	}
+	marshalJSON = marshaler
+}
+
+// SetJSONUnmarshaler replaces the unmarshaler of ParseForm and profiles, nil restores encoding/json.
+// ParseFormStrict keeps encoding/json for the unknown fields check
+func SetJSONUnmarshaler(unmarshaler JSONUnmarshaler) {
+	if unmarshaler == nil {
+		unmarshaler = json.Unmarshal
+	}
+	unmarshalJSON = unmarshaler
+}
@@ -0,0 +1,87 @@
+package core
+
+import (
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+type Fields map[string]interface{}
+
+// Logger is the logging facade used across the package,
+// set an adapter with SetLogger to integrate slog, zap etc.
+type Logger interface {
+	Debug(msg string, fields ...Fields)
+	Info(msg string, fields ...Fields)
+	Warn(msg string, fields ...Fields)
+	Error(msg string, fields ...Fields)
+	With(fields Fields) Logger
+}
+
+// loggerHolder keeps the stored type stable for atomic.Value whatever the adapter
+type loggerHolder struct {
+	logger Logger
+}
+
+var packageLogger atomic.Value
+
+func init() {
+	SetLogger(nil)
+}
+
+// SetLogger is safe to call while other goroutines are logging, nil restores the logrus default
+func SetLogger(l Logger) {
+	if l == nil {
+		l = NewLogrusLogger(logrus.StandardLogger())
+	}
+	packageLogger.Store(loggerHolder{logger: l})
+}
+
+func GetLogger() Logger {
+	return packageLogger.Load().(loggerHolder).logger
+}
+
+func mergeFields(fields []Fields) Fields {
+	merged := Fields{}
+	for _, f := range fields {
+		for k, v := range f {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+func NewLogrusLogger(l *logrus.Logger) Logger {
+	return &logrusLogger{entry: logrus.NewEntry(l)}
+}
+
+func (l *logrusLogger) with(fields []Fields) *logrus.Entry {
+	if len(fields) == 0 {
+		return l.entry
+	}
+	return l.entry.WithFields(logrus.Fields(mergeFields(fields)))
+}
+
+func (l *logrusLogger) Debug(msg string, fields ...Fields) {
+	l.with(fields).Debug(msg)
+}
+
+func (l *logrusLogger) Info(msg string, fields ...Fields) {
+	l.with(fields).Info(msg)
+}
+
+func (l *logrusLogger) Warn(msg string, fields ...Fields) {
+	l.with(fields).Warn(msg)
+}
+
+func (l *logrusLogger) Error(msg string, fields ...Fields) {
+	l.with(fields).Error(msg)
+}
+
+func (l *logrusLogger) With(fields Fields) Logger {
+	return &logrusLogger{entry: l.entry.WithFields(logrus.Fields(fields))}
+}
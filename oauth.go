@@ -16,6 +16,10 @@ const (
 	GrantTypeRefreshToken GrantType = "refresh_token"
 	ClientCredentials     GrantType = "client_credentials"
 	GrantTypePassword     GrantType = "password"
+	// GrantTypeAuthorizationCode exchanges a one-time code issued by the authorize endpoint
+	GrantTypeAuthorizationCode GrantType = "authorization_code"
+
+	DefaultAuthorizationCodeTTL = 10 * time.Minute
 )
 
 type TokenValues struct {
@@ -30,6 +34,8 @@ type GrantAccessTokenRequest struct {
 	ClientId     string
 	Username     string
 	Password     string
+	Code         string
+	RedirectURI  string
 }
 
 type GrantAccessTokenResponse struct {
@@ -41,12 +47,24 @@ type GrantAccessTokenResponse struct {
 
 type OAuth interface {
 	GrantAccessToken(ctx context.Context, req GrantAccessTokenRequest) (GrantAccessTokenResponse, error)
+	// IssueAuthorizationCode creates a code for the user authorized the client, to be exchanged with the same redirect uri.
+	// The client must be an OAuthAuthorizationCodeClient allowed the authorization_code grant with the redirect uri registered.
+	IssueAuthorizationCode(ctx context.Context, clientId string, redirectURI string, user UserInterface) (TokenValues, error)
 }
 
 type OAuthClient interface {
 	GetID() string
 }
 
+// OAuthAuthorizationCodeClient required for the authorization code grant, IssueAuthorizationCode checks the
+// client is allowed the grant and the redirect uri is registered. Other clients are refused codes.
+type OAuthAuthorizationCodeClient interface {
+	OAuthClient
+	// GetRedirectURIs registered for the authorization code grant, matched exactly
+	GetRedirectURIs() []string
+	GetGrantTypes() []string
+}
+
 type OAuthClientStorage interface {
 	Find(ctx context.Context, id string) (OAuthClient, error)
 	GetClient(ctx context.Context, id string, secret string, grantType GrantType) (OAuthClient, error)
@@ -86,6 +104,24 @@ type OAuthRefreshTokenStorage interface {
 	CreateRefreshToken(ctx context.Context, user UserInterface, client OAuthClient) (TokenValues, error)
 }
 
+// OAuthRefreshTokenRotator is implemented by refresh token storages with single use tokens
+type OAuthRefreshTokenRotator interface {
+	// RotateRefreshToken calls issue with the checked token and invalidates the token only when issue succeeds
+	RotateRefreshToken(ctx context.Context, token string, issue func(ctx context.Context, tok OAuthRefreshToken) error) error
+}
+
+type AuthorizationCode interface {
+	GetUserID() string
+	GetClientID() string
+	GetRedirectURI() string
+}
+
+type AuthorizationCodeStorage interface {
+	CreateAuthorizationCode(ctx context.Context, user UserInterface, client OAuthClient, redirectURI string) (TokenValues, error)
+	// ConsumeAuthorizationCode returns and invalidates the code, so it can be used only once
+	ConsumeAuthorizationCode(ctx context.Context, code string) (AuthorizationCode, error)
+}
+
 type UserStorage interface {
 	CheckCredentials(ctx context.Context, username, password string) (UserInterface, error)
 }
@@ -96,6 +132,7 @@ type oauth struct {
 	refreshTokenStorage OAuthRefreshTokenStorage
 	userStorage         UserStorage
 	userProvider        UserProvider
+	codeStorage         AuthorizationCodeStorage
 	accessTokenTTL      int
 	refreshTokenTTL     int
 }
@@ -108,13 +145,19 @@ func NewOAuth(
 	userProvider UserProvider,
 	accessTokenTTL int,
 	refreshTokenTTL int,
+	codeStorage ...AuthorizationCodeStorage,
 ) OAuth {
+	var cs AuthorizationCodeStorage
+	if len(codeStorage) > 0 {
+		cs = codeStorage[0]
+	}
 	return &oauth{
 		clientStorage:       storage,
 		accessTokenStorage:  accessTokenStorage,
 		refreshTokenStorage: refreshTokenStorage,
 		userStorage:         userStorage,
 		userProvider:        userProvider,
+		codeStorage:         cs,
 		accessTokenTTL:      accessTokenTTL,
 		refreshTokenTTL:     refreshTokenTTL,
 	}
@@ -131,9 +174,22 @@ func (a *oauth) GrantAccessToken(ctx context.Context, req GrantAccessTokenReques
 	case GrantTypePassword:
 		user, err = a.grantAccessTokenUserCredentials(ctx, req.Username, req.Password)
 	case GrantTypeRefreshToken:
-		user, err = a.grantAccessTokenRefresh(ctx, req.RefreshToken)
+		if rotator, ok := a.refreshTokenStorage.(OAuthRefreshTokenRotator); ok {
+			err = rotator.RotateRefreshToken(ctx, req.RefreshToken, func(ctx context.Context, tok OAuthRefreshToken) error {
+				user, err := a.refreshTokenUser(ctx, client, tok)
+				if err != nil {
+					return err
+				}
+				response, err = a.createAccessTokenResponse(ctx, user, client)
+				return err
+			})
+			return response, err
+		}
+		user, err = a.grantAccessTokenRefresh(ctx, client, req.RefreshToken)
 	case ClientCredentials:
 		user, err = a.grantAccessTokenClientCredentials(ctx, client)
+	case GrantTypeAuthorizationCode:
+		user, err = a.grantAccessTokenAuthorizationCode(ctx, client, req.Code, req.RedirectURI)
 	default:
 		return response, UnknownGrantTypeErr()
 	}
@@ -151,11 +207,18 @@ func (a *oauth) grantAccessTokenClientCredentials(ctx context.Context, client OA
 	return nil, nil
 }
 
-func (a *oauth) grantAccessTokenRefresh(ctx context.Context, token string) (UserInterface, error) {
+func (a *oauth) grantAccessTokenRefresh(ctx context.Context, client OAuthClient, token string) (UserInterface, error) {
 	tok, err := a.refreshTokenStorage.CheckCredentials(ctx, token)
 	if err != nil {
 		return nil, err
 	}
+	return a.refreshTokenUser(ctx, client, tok)
+}
+
+func (a *oauth) refreshTokenUser(ctx context.Context, client OAuthClient, tok OAuthRefreshToken) (UserInterface, error) {
+	if tok.GetClientID() != client.GetID() {
+		return nil, InvalidGrantErr()
+	}
 	if tok.GetUserID() != nil {
 		return a.userProvider.FindUserByID(ctx, *tok.GetUserID())
 	}
@@ -163,6 +226,44 @@ func (a *oauth) grantAccessTokenRefresh(ctx context.Context, token string) (User
 	return nil, nil
 }
 
+func (a *oauth) grantAccessTokenAuthorizationCode(ctx context.Context, client OAuthClient, code string, redirectURI string) (UserInterface, error) {
+	if a.codeStorage == nil {
+		return nil, UnknownGrantTypeErr()
+	}
+	if code == "" {
+		return nil, InvalidGrantErr()
+	}
+	authCode, err := a.codeStorage.ConsumeAuthorizationCode(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if authCode.GetClientID() != client.GetID() || authCode.GetRedirectURI() != redirectURI {
+		return nil, InvalidGrantErr()
+	}
+	return a.userProvider.FindUserByID(ctx, authCode.GetUserID())
+}
+
+func (a *oauth) IssueAuthorizationCode(ctx context.Context, clientId string, redirectURI string, user UserInterface) (TokenValues, error) {
+	if a.codeStorage == nil {
+		return TokenValues{}, UnknownGrantTypeErr()
+	}
+	if user == nil {
+		return TokenValues{}, AuthorizationRequiredErr()
+	}
+	client, err := a.clientStorage.Find(ctx, clientId)
+	if err != nil {
+		return TokenValues{}, err
+	}
+	codeClient, ok := client.(OAuthAuthorizationCodeClient)
+	if !ok || !StringsContains(codeClient.GetGrantTypes(), GrantTypeAuthorizationCode.String()) {
+		return TokenValues{}, UnknownGrantTypeErr()
+	}
+	if !StringsContains(codeClient.GetRedirectURIs(), redirectURI) {
+		return TokenValues{}, InvalidGrantErr("Redirect uri is not registered")
+	}
+	return a.codeStorage.CreateAuthorizationCode(ctx, user, client, redirectURI)
+}
+
 func (a *oauth) createAccessTokenResponse(ctx context.Context, user UserInterface, client OAuthClient) (GrantAccessTokenResponse, error) {
 	var response GrantAccessTokenResponse
 	at, err := a.accessTokenStorage.CreateAccessToken(ctx, user, client)
@@ -0,0 +1,340 @@
+package core
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+const (
+	OAuthClientsTable       = "oauth_clients"
+	OAuthAccessTokensTable  = "oauth_access_tokens"
+	OAuthRefreshTokensTable = "oauth_refresh_tokens"
+	OAuthAuthCodesTable     = "oauth_authorization_codes"
+
+	oauthTokenBytes = 32
+)
+
+// CreateOAuthTables creates the tables used by the DB OAuth storages if they do not exist,
+// tokens and client secrets are only stored as SHA-256 hashes
+func CreateOAuthTables(ctx context.Context, dal Dal) error {
+	queries := []string{
+		fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id TEXT PRIMARY KEY,
+			secret_hash TEXT NOT NULL,
+			grant_types TEXT[] NOT NULL DEFAULT '{}',
+			redirect_uris TEXT[] NOT NULL DEFAULT '{}'
+		)`, OAuthClientsTable),
+		// tables created before redirect uris were registered
+		fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS redirect_uris TEXT[] NOT NULL DEFAULT '{}'`, OAuthClientsTable),
+	}
+	for _, table := range []string{OAuthAccessTokensTable, OAuthRefreshTokensTable} {
+		queries = append(queries, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			token_hash TEXT PRIMARY KEY,
+			client_id TEXT NOT NULL REFERENCES %s (id) ON DELETE CASCADE,
+			user_id TEXT NULL,
+			expires_at TIMESTAMP NOT NULL
+		)`, table, OAuthClientsTable))
+	}
+	queries = append(queries, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			code_hash TEXT PRIMARY KEY,
+			client_id TEXT NOT NULL REFERENCES %s (id) ON DELETE CASCADE,
+			user_id TEXT NOT NULL,
+			redirect_uri TEXT NOT NULL,
+			expires_at TIMESTAMP NOT NULL
+		)`, OAuthAuthCodesTable, OAuthClientsTable))
+	return dal.Transactional(ctx, func(ctx context.Context) error {
+		for _, query := range queries {
+			if _, err := dal.DoExec(ctx, query); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PurgeExpiredOAuthTokens deletes the expired access tokens, refresh tokens and authorization codes,
+// run it periodically, e.g. from a scheduled command
+func PurgeExpiredOAuthTokens(ctx context.Context, dal Dal) (int64, error) {
+	var purged int64
+	err := dal.Transactional(ctx, func(ctx context.Context) error {
+		for _, table := range []string{OAuthAccessTokensTable, OAuthRefreshTokensTable, OAuthAuthCodesTable} {
+			res, err := dal.DoExec(ctx, fmt.Sprintf("DELETE FROM %s WHERE expires_at < $1", table), time.Now().UTC())
+			if err != nil {
+				return err
+			}
+			affected, err := res.RowsAffected()
+			if err != nil {
+				return Wrap(err)
+			}
+			purged += affected
+		}
+		return nil
+	})
+	return purged, err
+}
+
+type DBOAuthClient struct {
+	ID           string         `db:"id"`
+	SecretHash   string         `db:"secret_hash"`
+	GrantTypes   pq.StringArray `db:"grant_types"`
+	RedirectURIs pq.StringArray `db:"redirect_uris"`
+}
+
+func (c DBOAuthClient) GetID() string {
+	return c.ID
+}
+
+func (c DBOAuthClient) GetRedirectURIs() []string {
+	return c.RedirectURIs
+}
+
+func (c DBOAuthClient) GetGrantTypes() []string {
+	return c.GrantTypes
+}
+
+// DBOAuthToken an access or refresh token row
+type DBOAuthToken struct {
+	TokenHash string    `db:"token_hash"`
+	ClientID  string    `db:"client_id"`
+	UserID    *string   `db:"user_id"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+func (t DBOAuthToken) GetUserID() *string {
+	return t.UserID
+}
+
+func (t DBOAuthToken) GetClientID() string {
+	return t.ClientID
+}
+
+type DBOAuthClientStorage interface {
+	OAuthClientStorage
+	// CreateClient registers a client allowed to use the grant types and redirect uris (authorization code grant),
+	// the generated secret is only returned once
+	CreateClient(ctx context.Context, id string, redirectURIs []string, grantTypes ...GrantType) (string, error)
+}
+
+type dbOAuthClientStorage struct {
+	dal Dal
+}
+
+func NewDBOAuthClientStorage(dal Dal) DBOAuthClientStorage {
+	return &dbOAuthClientStorage{dal: dal}
+}
+
+func (s *dbOAuthClientStorage) Find(ctx context.Context, id string) (OAuthClient, error) {
+	var client DBOAuthClient
+	query := fmt.Sprintf("SELECT id, secret_hash, grant_types, redirect_uris FROM %s WHERE id = $1", OAuthClientsTable)
+	if err := s.dal.DoSelectOne(ctx, &client, query, id); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (s *dbOAuthClientStorage) GetClient(ctx context.Context, id string, secret string, grantType GrantType) (OAuthClient, error) {
+	found, err := s.Find(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	client := found.(DBOAuthClient)
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(HashToken(secret))) != 1 {
+		return nil, InvalidCredentialsErr()
+	}
+	if !StringsContains(client.GrantTypes, grantType.String()) {
+		return nil, UnknownGrantTypeErr()
+	}
+	return client, nil
+}
+
+func (s *dbOAuthClientStorage) CreateClient(ctx context.Context, id string, redirectURIs []string, grantTypes ...GrantType) (string, error) {
+	secret, err := GenerateToken(oauthTokenBytes)
+	if err != nil {
+		return "", Wrap(err)
+	}
+	types := make(pq.StringArray, len(grantTypes))
+	for i, g := range grantTypes {
+		types[i] = g.String()
+	}
+	query := fmt.Sprintf("INSERT INTO %s (id, secret_hash, grant_types, redirect_uris) VALUES ($1, $2, $3, $4)", OAuthClientsTable)
+	if _, err := s.dal.DoExec(ctx, query, id, HashToken(secret), types, pq.StringArray(redirectURIs)); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// dbOAuthTokenStorage shared by the access and refresh token storages
+type dbOAuthTokenStorage struct {
+	dal      Dal
+	table    string
+	ttl      time.Duration
+	notFound func(message ...string) error
+}
+
+func (s *dbOAuthTokenStorage) create(ctx context.Context, user UserInterface, client OAuthClient) (TokenValues, error) {
+	token, err := GenerateToken(oauthTokenBytes)
+	if err != nil {
+		return TokenValues{}, Wrap(err)
+	}
+	var userID *string
+	if user != nil {
+		id := user.GetID()
+		userID = &id
+	}
+	expiresAt := time.Now().UTC().Add(s.ttl)
+	query := fmt.Sprintf("INSERT INTO %s (token_hash, client_id, user_id, expires_at) VALUES ($1, $2, $3, $4)", s.table)
+	if _, err := s.dal.DoExec(ctx, query, HashToken(token), client.GetID(), userID, expiresAt); err != nil {
+		return TokenValues{}, err
+	}
+	return TokenValues{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+// find looks the token up by its hash, a locked row stays locked until the transaction of ctx ends
+func (s *dbOAuthTokenStorage) find(ctx context.Context, token string, lock bool) (DBOAuthToken, error) {
+	var row DBOAuthToken
+	query := fmt.Sprintf("SELECT token_hash, client_id, user_id, expires_at FROM %s WHERE token_hash = $1", s.table)
+	if lock {
+		query += " FOR UPDATE"
+	}
+	err := s.dal.DoSelectOne(ctx, &row, query, HashToken(token))
+	var notFound ObjectNotFound
+	if errors.As(err, &notFound) {
+		return row, s.notFound()
+	}
+	if err != nil {
+		return row, err
+	}
+	if time.Now().UTC().After(row.ExpiresAt) {
+		return row, AuthorizationExpiredErr()
+	}
+	return row, nil
+}
+
+type dbOAuthAccessTokenStorage struct {
+	dbOAuthTokenStorage
+}
+
+func NewDBOAuthAccessTokenStorage(dal Dal, ttl time.Duration) OAuthAccessTokenStorage {
+	return &dbOAuthAccessTokenStorage{dbOAuthTokenStorage{dal: dal, table: OAuthAccessTokensTable, ttl: ttl, notFound: AuthorizationRequiredErr}}
+}
+
+func (s *dbOAuthAccessTokenStorage) CheckCredentials(ctx context.Context, token string) (OAuthAccessToken, error) {
+	row, err := s.find(ctx, token, false)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+func (s *dbOAuthAccessTokenStorage) CreateAccessToken(ctx context.Context, user UserInterface, client OAuthClient) (TokenValues, error) {
+	return s.create(ctx, user, client)
+}
+
+type dbOAuthRefreshTokenStorage struct {
+	dbOAuthTokenStorage
+}
+
+// NewDBOAuthRefreshTokenStorage refresh tokens are single use, the OAuth refresh grant rotates them with
+// RotateRefreshToken, use the same dal for the access token storage so the rotation is one transaction
+func NewDBOAuthRefreshTokenStorage(dal Dal, ttl time.Duration) OAuthRefreshTokenStorage {
+	return &dbOAuthRefreshTokenStorage{dbOAuthTokenStorage{dal: dal, table: OAuthRefreshTokensTable, ttl: ttl, notFound: InvalidGrantErr}}
+}
+
+func (s *dbOAuthRefreshTokenStorage) CheckCredentials(ctx context.Context, token string) (OAuthRefreshToken, error) {
+	row, err := s.find(ctx, token, false)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
+
+// RotateRefreshToken locks the token row while issue creates the new tokens and deletes it in the same transaction,
+// when issue fails the transaction rolls back and the old token stays usable
+func (s *dbOAuthRefreshTokenStorage) RotateRefreshToken(ctx context.Context, token string, issue func(ctx context.Context, tok OAuthRefreshToken) error) error {
+	return s.dal.Transactional(ctx, func(ctx context.Context) error {
+		row, err := s.find(ctx, token, true)
+		if err != nil {
+			return err
+		}
+		if err := issue(ctx, row); err != nil {
+			return err
+		}
+		_, err = s.dal.DoExec(ctx, fmt.Sprintf("DELETE FROM %s WHERE token_hash = $1", s.table), row.TokenHash)
+		return err
+	})
+}
+
+func (s *dbOAuthRefreshTokenStorage) CreateRefreshToken(ctx context.Context, user UserInterface, client OAuthClient) (TokenValues, error) {
+	return s.create(ctx, user, client)
+}
+
+type DBOAuthAuthorizationCode struct {
+	CodeHash    string    `db:"code_hash"`
+	ClientID    string    `db:"client_id"`
+	UserID      string    `db:"user_id"`
+	RedirectURI string    `db:"redirect_uri"`
+	ExpiresAt   time.Time `db:"expires_at"`
+}
+
+func (c DBOAuthAuthorizationCode) GetUserID() string {
+	return c.UserID
+}
+
+func (c DBOAuthAuthorizationCode) GetClientID() string {
+	return c.ClientID
+}
+
+func (c DBOAuthAuthorizationCode) GetRedirectURI() string {
+	return c.RedirectURI
+}
+
+type dbAuthorizationCodeStorage struct {
+	dal Dal
+	ttl time.Duration
+}
+
+// NewDBAuthorizationCodeStorage ttl defaults to DefaultAuthorizationCodeTTL
+func NewDBAuthorizationCodeStorage(dal Dal, ttl ...time.Duration) AuthorizationCodeStorage {
+	s := &dbAuthorizationCodeStorage{dal: dal, ttl: DefaultAuthorizationCodeTTL}
+	if len(ttl) > 0 && ttl[0] > 0 {
+		s.ttl = ttl[0]
+	}
+	return s
+}
+
+func (s *dbAuthorizationCodeStorage) CreateAuthorizationCode(ctx context.Context, user UserInterface, client OAuthClient, redirectURI string) (TokenValues, error) {
+	code, err := GenerateToken(oauthTokenBytes)
+	if err != nil {
+		return TokenValues{}, Wrap(err)
+	}
+	expiresAt := time.Now().UTC().Add(s.ttl)
+	query := fmt.Sprintf("INSERT INTO %s (code_hash, client_id, user_id, redirect_uri, expires_at) VALUES ($1, $2, $3, $4, $5)", OAuthAuthCodesTable)
+	if _, err := s.dal.DoExec(ctx, query, HashToken(code), client.GetID(), user.GetID(), redirectURI, expiresAt); err != nil {
+		return TokenValues{}, err
+	}
+	return TokenValues{Token: code, ExpiresAt: expiresAt}, nil
+}
+
+func (s *dbAuthorizationCodeStorage) ConsumeAuthorizationCode(ctx context.Context, code string) (AuthorizationCode, error) {
+	var row DBOAuthAuthorizationCode
+	err := s.dal.Transactional(ctx, func(ctx context.Context) error {
+		query := fmt.Sprintf("DELETE FROM %s WHERE code_hash = $1 RETURNING code_hash, client_id, user_id, redirect_uri, expires_at", OAuthAuthCodesTable)
+		return s.dal.DoSelectOne(ctx, &row, query, HashToken(code))
+	})
+	var notFound ObjectNotFound
+	if errors.As(err, &notFound) {
+		return nil, InvalidGrantErr()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().UTC().After(row.ExpiresAt) {
+		return nil, InvalidGrantErr()
+	}
+	return row, nil
+}
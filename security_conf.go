@@ -1,9 +1,37 @@
 package core
 
+// FirewallConfig areas are matched against the request path in order and the first matching one wins,
+// see FirewallOptions.LongestMatch to apply the most specific one instead
 type FirewallConfig []Area
 
+// RoleHierarchy maps a role to the roles it inherits, e.g. ROLE_ADMIN: [ROLE_USER]
 type RoleHierarchy map[string][]string
 
+// ReachableRoles returns the given roles together with every inherited one
+func (h RoleHierarchy) ReachableRoles(roles []string) []string {
+	seen := make(map[string]bool)
+	var reachable []string
+	var walk func(role string)
+	walk = func(role string) {
+		if seen[role] {
+			return
+		}
+		seen[role] = true
+		reachable = append(reachable, role)
+		for _, inherited := range h[role] {
+			walk(inherited)
+		}
+	}
+	for _, role := range roles {
+		walk(role)
+	}
+	return reachable
+}
+
+func (h RoleHierarchy) IsGranted(roles []string, role string) bool {
+	return StringsContains(h.ReachableRoles(roles), role)
+}
+
 type RbacConfig struct {
 	RoleHierarchy RoleHierarchy
 }
@@ -2,14 +2,18 @@ package core
 
 import (
 	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"html/template"
+	"io/fs"
 	"os"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
-
-	logger "github.com/sirupsen/logrus"
+	"sync"
 )
 
 type block struct {
@@ -28,46 +32,232 @@ type Vars map[string]interface{}
 
 type TemplatingEngine interface {
 	Render(tpl string, vars interface{}) (bytes.Buffer, error)
+	// Warmup parses the given entry templates upfront and caches them, the first parse error is returned.
+	// Without names every file of the template dir with one of TemplatingConfig.Extensions is parsed.
+	Warmup(templates ...string) error
 }
 
 type engine struct {
 	templateDir string
 	templates   map[string]*template.Template
+	compiledMu  sync.RWMutex
+	compiled    map[string]*template.Template
 
 	functions   template.FuncMap
+	router      Router
+	staticFiles *StaticFiles
+	assetHash   bool
+	minify      bool
+	assetMu     sync.RWMutex
+	assetHashes map[string]string
+	csrfField   string
+	extensions  []string
+}
+
+type TemplatingConfig struct {
+	TemplateDir string
+	Functions   template.FuncMap
+	// Router enables the path function
+	Router Router
+	// StaticFiles the router static files config used by the asset function
+	StaticFiles *StaticFiles
+	// AssetHash appends a ?v=<content hash> cache buster to asset urls
+	AssetHash bool
+	// Minify strips comments and collapses whitespace of the rendered html, pre/textarea/script/style are kept as is
+	Minify bool
+	// CSRFFieldName the CSRFConfig.FieldName of the CSRF middleware rendered by csrf_field, DefaultCSRFFieldName by default
+	CSRFFieldName string
+	// Extensions of the files parsed by Warmup, DefaultTemplateExtensions by default
+	Extensions []string
 }
 
+var DefaultTemplateExtensions = []string{".html", ".tmpl", ".gohtml"}
+
 func NewTemplatingEngine(templateDir string, functions template.FuncMap) TemplatingEngine {
+	return NewTemplatingEngineWithConfig(TemplatingConfig{TemplateDir: templateDir, Functions: functions})
+}
+
+// NewTemplatingEngineWithConfig besides include and the safe functions registers
+//
+//	{{ path "user_show" "id" .ID }}
+//	{{ asset "css/app.css" }}
+//	{{ csrf_field .Request }}
+func NewTemplatingEngineWithConfig(cfg TemplatingConfig) TemplatingEngine {
 	e := &engine{
-		templateDir: templateDir,
+		templateDir: cfg.TemplateDir,
 		templates:   make(map[string]*template.Template),
+		compiled:    make(map[string]*template.Template),
+		router:      cfg.Router,
+		staticFiles: cfg.StaticFiles,
+		assetHash:   cfg.AssetHash,
+		minify:      cfg.Minify,
+		assetHashes: make(map[string]string),
+		csrfField:   cfg.CSRFFieldName,
+		extensions:  cfg.Extensions,
+	}
+	if len(e.extensions) == 0 {
+		e.extensions = DefaultTemplateExtensions
 	}
-	e.registerFunctions(functions)
+	e.registerFunctions(cfg.Functions)
 	return e
 }
 
+// registerFunctions adds the built-in functions, caller functions with the same name take precedence.
+// safeHTML, safeURL and safeJS mark trusted values safe and bypass html/template escaping, never pass user input.
+// include inserts the rendered template as text, so its markup is escaped, include_raw opts in to inserting
+// it unescaped (its output was already escaped while rendering).
 func (e *engine) registerFunctions(functions template.FuncMap) {
-	functions["include"] = func(tpl string, vars interface{}) template.HTML {
-		buffer, err := e.Render(tpl, vars)
-		if err != nil {
-			logger.Error(err)
-			return ""
-		}
-		return template.HTML(buffer.String())
+	builtin := template.FuncMap{
+		"include": func(tpl string, vars interface{}) string {
+			return string(e.include(tpl, vars))
+		},
+		"include_raw": e.include,
+		"safeHTML":    safeHTML,
+		"safeURL": func(v interface{}) template.URL {
+			return template.URL(fmt.Sprint(v))
+		},
+		"safeJS": func(v interface{}) template.JS {
+			return template.JS(fmt.Sprint(v))
+		},
+		"path":  e.path,
+		"asset": e.asset,
+		// {{ range flashes .Request "success" }}{{ .Message }}{{ end }}
+		"flashes": func(req Request, category ...string) []FlashMessage {
+			return req.Flashes(category...)
+		},
+		// {{ csrf_field .Request }} hidden input carrying the token of the CSRF middleware
+		"csrf_field": func(req Request) template.HTML {
+			return CSRFConfig{FieldName: e.csrfField}.Field(req.CSRFToken())
+		},
+	}
+	for name, fn := range functions {
+		builtin[name] = fn
+	}
+	e.functions = builtin
+}
+
+func (e *engine) include(tpl string, vars interface{}) template.HTML {
+	buffer, err := e.Render(tpl, vars)
+	if err != nil {
+		GetLogger().Error("template include failed", Fields{"template": tpl, "error": err.Error()})
+		return ""
+	}
+	return template.HTML(buffer.String())
+}
+
+func (e *engine) path(name string, params ...interface{}) (string, error) {
+	if e.router == nil {
+		return "", errors.New("path function requires TemplatingConfig.Router")
+	}
+	return e.router.URL(name, params...)
+}
+
+func (e *engine) asset(file string) string {
+	if e.staticFiles == nil {
+		return file
+	}
+	prefix := strings.TrimSuffix(e.staticFiles.Path, "{filepath:*}")
+	assetPath := normalize(fmt.Sprintf("%s/%s", prefix, strings.TrimLeft(file, "/")))
+	if !e.assetHash {
+		return assetPath
+	}
+	if hash := e.assetVersion(file); hash != "" {
+		return fmt.Sprintf("%s?v=%s", assetPath, hash)
+	}
+	return assetPath
+}
+
+// assetVersion short content hash of the static file, cached per file
+func (e *engine) assetVersion(file string) string {
+	e.assetMu.RLock()
+	hash, ok := e.assetHashes[file]
+	e.assetMu.RUnlock()
+	if ok {
+		return hash
 	}
-	e.functions = functions
+	content, err := os.ReadFile(filepath.Join(e.staticFiles.RootDir, filepath.Clean("/"+file)))
+	if err != nil {
+		GetLogger().Warn("asset version unavailable", Fields{"file": file, "error": err.Error()})
+		return ""
+	}
+	sum := md5.Sum(content)
+	hash = hex.EncodeToString(sum[:])[:8]
+	e.assetMu.Lock()
+	e.assetHashes[file] = hash
+	e.assetMu.Unlock()
+	return hash
+}
+
+func safeHTML(v interface{}) template.HTML {
+	return template.HTML(fmt.Sprint(v))
 }
 
 func (e *engine) Render(tpl string, vars interface{}) (bytes.Buffer, error) {
 	buf := bytes.Buffer{}
+	e.compiledMu.RLock()
+	tmpl, ok := e.compiled[tpl]
+	e.compiledMu.RUnlock()
+	if !ok {
+		var err error
+		if tmpl, err = e.compile(tpl); err != nil {
+			return buf, err
+		}
+		e.compiledMu.Lock()
+		e.compiled[tpl] = tmpl
+		e.compiledMu.Unlock()
+	}
+	if err := tmpl.ExecuteTemplate(&buf, path.Base(tpl), vars); err != nil {
+		return buf, err
+	}
+	if e.minify {
+		minified := minifyHTML(buf.Bytes())
+		buf.Reset()
+		buf.Write(minified)
+	}
+	return buf, nil
+}
+
+func (e *engine) Warmup(templates ...string) error {
+	if len(templates) == 0 {
+		err := filepath.WalkDir(e.templateDir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !StringsContains(e.extensions, strings.ToLower(filepath.Ext(file))) {
+				return err
+			}
+			name, err := filepath.Rel(e.templateDir, file)
+			if err != nil {
+				return err
+			}
+			templates = append(templates, filepath.ToSlash(name))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	compiled := make(map[string]*template.Template, len(templates))
+	for _, name := range templates {
+		tmpl, err := e.compile(name)
+		if err != nil {
+			return fmt.Errorf("template %s: %w", name, err)
+		}
+		compiled[name] = tmpl
+	}
+	e.compiledMu.Lock()
+	for name, tmpl := range compiled {
+		e.compiled[name] = tmpl
+	}
+	e.compiledMu.Unlock()
+	return nil
+}
+
+// compile resolves the extend/block inheritance of tpl and parses the result
+func (e *engine) compile(tpl string) (*template.Template, error) {
 	t, err := parse(tpl, e.templateDir)
-	cont := e.buildContent(t, []block{})
-	tmpl, err := template.New(path.Base(tpl)).Funcs(e.functions).Parse(cont)
 	if err != nil {
-		return buf, err
+		return nil, err
 	}
-	err = tmpl.ExecuteTemplate(&buf, path.Base(tpl), vars)
-	return buf, err
+	cont := e.buildContent(t, []block{})
+	return template.New(path.Base(tpl)).Funcs(e.functions).Parse(cont)
 }
 
 func (e *engine) buildContent(tpl htmlTemplate, blocks []block) string {
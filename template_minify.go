@@ -0,0 +1,36 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+var (
+	minifyPreservedRe   = regexp.MustCompile(`(?is)<pre\b.*?</pre>|<textarea\b.*?</textarea>|<script\b.*?</script>|<style\b.*?</style>`)
+	minifyPlaceholderRe = regexp.MustCompile("<\x00(\\d+)\x00>")
+	minifyCommentRe     = regexp.MustCompile(`(?s)<!--[^\[].*?-->`)
+	minifyBetweenTagsRe = regexp.MustCompile(`>\s*\n\s*<`)
+	minifyWhitespaceRe  = regexp.MustCompile(`\s{2,}`)
+)
+
+// minifyHTML strips comments (conditional ones are kept), drops line break indentation between tags and
+// collapses whitespace runs. Content of pre, textarea, script and style elements is left untouched.
+func minifyHTML(html []byte) []byte {
+	// preserved elements are swapped for tag like placeholders, so the surrounding whitespace is minified too
+	var preserved [][]byte
+	html = minifyPreservedRe.ReplaceAllFunc(html, func(m []byte) []byte {
+		preserved = append(preserved, m)
+		return []byte(fmt.Sprintf("<\x00%d\x00>", len(preserved)-1))
+	})
+	html = minifyCommentRe.ReplaceAll(html, nil)
+	html = minifyBetweenTagsRe.ReplaceAll(html, []byte("><"))
+	html = minifyWhitespaceRe.ReplaceAll(html, []byte(" "))
+	return minifyPlaceholderRe.ReplaceAllFunc(html, func(m []byte) []byte {
+		i, err := strconv.Atoi(string(m[2 : len(m)-2]))
+		if err != nil || i >= len(preserved) {
+			return m
+		}
+		return preserved[i]
+	})
+}
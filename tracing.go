@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	TracerName               = "github.com/punqy/core"
+	RequestValueTraceContext = "trace-context"
+)
+
+// requestHeaderCarrier adapts fasthttp request headers to propagation.TextMapCarrier
+type requestHeaderCarrier struct {
+	req Request
+}
+
+func (c requestHeaderCarrier) Get(key string) string {
+	return string(c.req.Request.Header.Peek(key))
+}
+
+func (c requestHeaderCarrier) Set(key string, value string) {
+	c.req.Request.Header.Set(key, value)
+}
+
+func (c requestHeaderCarrier) Keys() []string {
+	var keys []string
+	c.req.Request.Header.VisitAll(func(key, value []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// NewTracingMiddleware starts a server span per request, continuing the trace from incoming headers.
+// The span context is stored on the request, so the DAL and handlers pick it up as a parent.
+func NewTracingMiddleware(tp trace.TracerProvider, propagator ...propagation.TextMapPropagator) Middleware {
+	var prop propagation.TextMapPropagator = propagation.TraceContext{}
+	if len(propagator) > 0 {
+		prop = propagator[0]
+	}
+	tracer := tp.Tracer(TracerName)
+	return func(req Request, next Handler) Response {
+		route := req.Route().Pattern()
+		ctx := prop.Extract(context.Background(), requestHeaderCarrier{req: req})
+		ctx, span := tracer.Start(ctx, fmt.Sprintf("%s %s", req.Method(), route),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.method", string(req.Method())),
+				attribute.String("http.route", route),
+				attribute.String("http.target", string(req.RequestURI())),
+				attribute.String("http.request_id", req.RequestID()),
+			),
+		)
+		defer span.End()
+		TraceContextValue.Set(req, ctx)
+
+		resp := next(req)
+		span.SetAttributes(attribute.Int("http.status_code", resp.GetCode()))
+		if err := resp.GetError(); err != nil {
+			span.RecordError(err)
+		}
+		if resp.GetCode() >= 500 {
+			span.SetStatus(codes.Error, fmt.Sprintf("%d", resp.GetCode()))
+		}
+		return resp
+	}
+}
+
+// traceContext returns the context holding the current span.
+// fasthttp request context only exposes string keyed user values,
+// so the span context set by the tracing middleware is looked up explicitly.
+func traceContext(ctx context.Context) context.Context {
+	if tc, ok := TraceContextValue.Get(ctx); ok {
+		return tc
+	}
+	return ctx
+}
+
+func startQuerySpan(ctx context.Context, tracer trace.Tracer, query, tag string) trace.Span {
+	attrs := []attribute.KeyValue{attribute.String("db.statement", query)}
+	if tag != "" {
+		attrs = append(attrs, attribute.String("db.query.tag", tag))
+	}
+	_, span := tracer.Start(traceContext(ctx), "db.query",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+	return span
+}
+
+func endQuerySpan(span trace.Span, duration float64, err error) {
+	span.SetAttributes(attribute.Float64("db.duration", duration))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}